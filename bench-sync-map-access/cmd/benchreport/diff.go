@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"strconv"
+)
+
+// DiffRow compares a benchmark of two runs
+type DiffRow struct {
+	Package     string  `json:"package"`
+	Name        string  `json:"name"`
+	Procs       int     `json:"procs"`
+	OldNsPerOp  float64 `json:"old_ns_per_op"`
+	NewNsPerOp  float64 `json:"new_ns_per_op"`
+	Delta       float64 `json:"delta"` // change of ns/op in percent
+	OldAllocs   float64 `json:"old_allocs_per_op"`
+	NewAllocs   float64 `json:"new_allocs_per_op"`
+	Regression  bool    `json:"regression"`
+	Improvement bool    `json:"improvement"`
+	Missing     bool    `json:"missing"` // the benchmark is not in the new run
+}
+
+// Diff compares the benchmarks of two runs. A benchmark regresses if its ns/op or its allocs/op grow by more than
+// threshold percent, and improves if its ns/op drops by more than threshold percent. The benchmarks of the old run
+// that are not in the new run are reported as missing (after the other rows), the new benchmarks are skipped.
+func Diff(old, new []Result, threshold float64) []DiffRow {
+	oldResults := average(old)
+	previous := map[key]Result{}
+	for _, res := range oldResults {
+		previous[key{res.Package, res.Name, res.Procs}] = res
+	}
+	var rows []DiffRow
+	for _, res := range average(new) {
+		k := key{res.Package, res.Name, res.Procs}
+		prev, ok := previous[k]
+		if !ok {
+			continue
+		}
+		delete(previous, k)
+		row := DiffRow{
+			Package:    res.Package,
+			Name:       res.Name,
+			Procs:      res.Procs,
+			OldNsPerOp: prev.Metrics["ns/op"],
+			NewNsPerOp: res.Metrics["ns/op"],
+			OldAllocs:  prev.Metrics["allocs/op"],
+			NewAllocs:  res.Metrics["allocs/op"],
+		}
+		if row.OldNsPerOp > 0 {
+			row.Delta = (row.NewNsPerOp - row.OldNsPerOp) / row.OldNsPerOp * 100
+		}
+		row.Regression = row.Delta > threshold || allocsRegressed(row.OldAllocs, row.NewAllocs, threshold)
+		row.Improvement = !row.Regression && row.Delta < -threshold
+		rows = append(rows, row)
+	}
+	for _, prev := range oldResults {
+		if _, ok := previous[key{prev.Package, prev.Name, prev.Procs}]; !ok {
+			continue
+		}
+		rows = append(rows, DiffRow{
+			Package:    prev.Package,
+			Name:       prev.Name,
+			Procs:      prev.Procs,
+			OldNsPerOp: prev.Metrics["ns/op"],
+			OldAllocs:  prev.Metrics["allocs/op"],
+			Missing:    true,
+		})
+	}
+	return rows
+}
+
+// allocsRegressed reports whether the allocs/op grew by more than threshold percent. The averages of the runs
+// can have a fraction of an allocation (e.g. the growth of a map amortized over the operations), so a growth of
+// less than one allocation per operation is never a regression, and any new allocation of a benchmark that did
+// not allocate is.
+func allocsRegressed(old, new, threshold float64) bool {
+	if new-old < 1 {
+		return false
+	}
+	return old == 0 || (new-old)/old*100 > threshold
+}
+
+// Missing returns the number of benchmarks of a diff that are not in the new run
+func Missing(rows []DiffRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.Missing {
+			n++
+		}
+	}
+	return n
+}
+
+// Regressions returns the number of regressions of a diff
+func Regressions(rows []DiffRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.Regression {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteDiff writes the rows of a diff
+func WriteDiff(w io.Writer, rows []DiffRow, f Format) error {
+	t := table{
+		header: []string{"package", "benchmark", "procs", "old ns/op", "new ns/op", "delta", "old allocs/op", "new allocs/op", "status"},
+		values: rows,
+	}
+	for _, r := range rows {
+		status := ""
+		switch {
+		case r.Missing:
+			t.rows = append(t.rows, []string{
+				r.Package, r.Name, strconv.Itoa(r.Procs),
+				formatFloat(r.OldNsPerOp), "-", "-", formatFloat(r.OldAllocs), "-", "MISSING",
+			})
+			continue
+		case r.Regression:
+			status = "REGRESSION"
+		case r.Improvement:
+			status = "improvement"
+		}
+		t.rows = append(t.rows, []string{
+			r.Package, r.Name, strconv.Itoa(r.Procs),
+			formatFloat(r.OldNsPerOp), formatFloat(r.NewNsPerOp), strconv.FormatFloat(r.Delta, 'f', 1, 64) + "%",
+			formatFloat(r.OldAllocs), formatFloat(r.NewAllocs), status,
+		})
+	}
+	return t.write(w, f)
+}
@@ -0,0 +1,207 @@
+// Command benchreport runs the benchmark suites of the repository with several GOMAXPROCS values and reports
+// ns/op, B/op, allocs/op, the speedup of every implementation and the scaling with GOMAXPROCS, or compares two
+// saved runs and flags the regressions.
+//
+//	benchreport run [-suites mapaccess,ipfirewall] [-cpu 1,2,4,8] [-bench .] [-o run.json] [-format markdown]
+//	benchreport report [-format csv] run.json...
+//	benchreport diff [-threshold 5] old.json new.json
+//
+// Runs are saved as JSON, the raw output of `go test -bench` is also accepted. It must be run from
+// bench-sync-map-access (the suites are found relative to it).
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(os.Args[2:])
+	case "report":
+		err = reportCmd(os.Args[2:])
+	case "diff":
+		err = diffCmd(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "benchreport:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: benchreport run|report|diff [flags] [files]")
+	os.Exit(2)
+}
+
+// reportFlags are the flags of the commands writing a report
+type reportFlags struct {
+	format   *string
+	impl     *string
+	baseline *string
+}
+
+func addReportFlags(fs *flag.FlagSet) reportFlags {
+	return reportFlags{
+		format:   fs.String("format", "markdown", "output format: markdown, csv or json"),
+		impl:     fs.String("impl", "", "regexp with an `impl` group selecting the implementation in the benchmark names (default per suite)"),
+		baseline: fs.String("baseline", "", "implementation of reference for the speedups (default per suite, the slowest if absent)"),
+	}
+}
+
+func (f reportFlags) write(w io.Writer, results []Result) error {
+	format, err := ParseFormat(*f.format)
+	if err != nil {
+		return err
+	}
+	opts := ReportOptions{Baseline: *f.baseline}
+	if *f.impl != "" {
+		if opts.Impl, err = regexp.Compile(*f.impl); err != nil {
+			return err
+		}
+		if opts.Impl.SubexpIndex("impl") < 0 {
+			return errors.New("the -impl regexp has no `impl` group")
+		}
+	}
+	return WriteReport(w, Report(results, opts), format)
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	names := fs.String("suites", "mapaccess", "comma-separated suites: "+strings.Join(suiteNames(), ", "))
+	cpu := fs.String("cpu", "1,2,4,8", "comma-separated GOMAXPROCS values")
+	bench := fs.String("bench", ".", "benchmarks to run (see go test -bench)")
+	benchtime := fs.String("benchtime", "1s", "see go test -benchtime")
+	count := fs.String("count", "1", "runs of every benchmark (averaged)")
+	out := fs.String("o", "", "save the run as JSON to this file")
+	rf := addReportFlags(fs)
+	fs.Parse(args)
+
+	var results []Result
+	for _, name := range strings.Split(*names, ",") {
+		s, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown suite %q", name)
+		}
+		if !inModule(s.dir) {
+			return fmt.Errorf("suite %s: %s is not in a Go module (add a go.mod, e.g. with `go mod init` and `go mod tidy`)", name, s.dir)
+		}
+		var stdout bytes.Buffer
+		cmd := exec.Command("go", "test", "-run", "^$", "-bench", *bench, "-benchmem",
+			"-cpu", *cpu, "-benchtime", *benchtime, "-count", *count, ".")
+		cmd.Dir = s.dir
+		cmd.Stdout = io.MultiWriter(&stdout, os.Stderr) // progress
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("suite %s: %w", name, err)
+		}
+		res, err := ParseResults(&stdout)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+	}
+
+	if *out != "" {
+		if err := saveResults(*out, results); err != nil {
+			return err
+		}
+	}
+	return rf.write(os.Stdout, results)
+}
+
+func reportCmd(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	rf := addReportFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("report: no saved run")
+	}
+	var results []Result
+	for _, file := range fs.Args() {
+		res, err := loadFile(file)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+	}
+	return rf.write(os.Stdout, results)
+}
+
+func diffCmd(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown, csv or json")
+	threshold := fs.Float64("threshold", 5, "change of ns/op or allocs/op (in percent) flagged as a regression or an improvement")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("diff: expected two saved runs (old and new)")
+	}
+	f, err := ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	old, err := loadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := loadFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	rows := Diff(old, new, *threshold)
+	if err := WriteDiff(os.Stdout, rows, f); err != nil {
+		return err
+	}
+	if n := Missing(rows); n > 0 {
+		fmt.Fprintf(os.Stderr, "diff: %d benchmark(s) missing from the new run\n", n)
+	}
+	if n := Regressions(rows); n > 0 {
+		return fmt.Errorf("%d regression(s) over %g%%", n, *threshold)
+	}
+	return nil
+}
+
+func loadFile(name string) ([]Result, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadResults(f)
+}
+
+func saveResults(name string, results []Result) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := (table{values: results}).write(f, FormatJSON); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func suiteNames() []string {
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
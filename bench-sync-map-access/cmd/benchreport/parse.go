@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Result is a single line of the output of `go test -bench`.
+type Result struct {
+	Package    string             `json:"package"`
+	Name       string             `json:"name"`  // without the GOMAXPROCS suffix
+	Procs      int                `json:"procs"` // GOMAXPROCS
+	Iterations int                `json:"iterations"`
+	Metrics    map[string]float64 `json:"metrics"` // ns/op, B/op, allocs/op and the custom metrics
+}
+
+// procsSuffix is the GOMAXPROCS suffix of a benchmark name (absent when GOMAXPROCS is 1).
+var procsSuffix = regexp.MustCompile(`-(\d+)$`)
+
+// ParseResults parses the output of `go test -bench` (the other lines are ignored).
+func ParseResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	pkg := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(p)
+			continue
+		}
+		if res, ok := parseLine(line); ok {
+			res.Package = pkg
+			results = append(results, res)
+		}
+	}
+	return results, scanner.Err()
+}
+
+// parseLine parses a line like `BenchmarkGet-8   1000   172.0 ns/op   0 B/op   0 allocs/op`.
+func parseLine(line string) (Result, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+		return Result{}, false
+	}
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Result{}, false
+	}
+	res := Result{Name: fields[0], Procs: 1, Iterations: iterations, Metrics: map[string]float64{}}
+	if m := procsSuffix.FindStringSubmatch(res.Name); m != nil {
+		res.Procs, _ = strconv.Atoi(m[1])
+		res.Name = strings.TrimSuffix(res.Name, m[0])
+	}
+	for i := 2; i+1 < len(fields); i += 2 {
+		val, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Result{}, false
+		}
+		res.Metrics[fields[i+1]] = val
+	}
+	return res, true
+}
+
+// LoadResults reads a saved run: the JSON written by `benchreport run -o` or the raw output of `go test -bench`.
+func LoadResults(r io.Reader) ([]Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var results []Result
+		err := json.Unmarshal(trimmed, &results)
+		return results, err
+	}
+	return ParseResults(bytes.NewReader(data))
+}
+
+// key identifies a benchmark of a run.
+type key struct {
+	Package string
+	Name    string
+	Procs   int
+}
+
+// average merges the results of the same benchmark (e.g. with `-count`) by averaging their metrics.
+// The order of the first result of every benchmark is kept.
+func average(results []Result) []Result {
+	var merged []Result
+	index := map[key]int{}
+	counts := map[key]map[string]int{}
+	for _, res := range results {
+		k := key{res.Package, res.Name, res.Procs}
+		idx, ok := index[k]
+		if !ok {
+			index[k] = len(merged)
+			counts[k] = map[string]int{}
+			merged = append(merged, Result{Package: res.Package, Name: res.Name, Procs: res.Procs, Metrics: map[string]float64{}})
+			idx = len(merged) - 1
+		}
+		merged[idx].Iterations += res.Iterations
+		for unit, val := range res.Metrics {
+			merged[idx].Metrics[unit] += val
+			counts[k][unit]++
+		}
+	}
+	for i := range merged {
+		k := key{merged[i].Package, merged[i].Name, merged[i].Procs}
+		for unit, n := range counts[k] {
+			merged[i].Metrics[unit] /= float64(n)
+		}
+	}
+	return merged
+}
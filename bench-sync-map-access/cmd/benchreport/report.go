@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Row is a benchmark of a report
+type Row struct {
+	Package     string  `json:"package"`
+	Name        string  `json:"name"`
+	Impl        string  `json:"impl,omitempty"` // implementation (empty if the benchmark is not compared)
+	Procs       int     `json:"procs"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+	P99         float64 `json:"p99_ns,omitempty"`               // 99th percentile of the latency (mapaccess)
+	MutexWait   float64 `json:"mutex_wait_ns_per_op,omitempty"` // time blocked on the locks per operation (mapaccess)
+	Speedup     float64 `json:"speedup,omitempty"`              // ns/op of the baseline over ns/op of the implementation
+	Scaling     float64 `json:"scaling,omitempty"`              // ns/op with the lowest GOMAXPROCS over ns/op with Procs
+}
+
+// ReportOptions overrides the implementations and the baselines of the suites
+type ReportOptions struct {
+	Impl     *regexp.Regexp // pattern with an `impl` group for all the packages
+	Baseline string
+}
+
+// Report averages the results and computes the speedup of every implementation against the baseline (or the slowest
+// implementation) of the same benchmark with the same GOMAXPROCS, and the scaling of every benchmark with GOMAXPROCS.
+func Report(results []Result, opts ReportOptions) []Row {
+	type groupKey struct {
+		pkg, group string
+		procs      int
+	}
+	type scaleKey struct {
+		pkg, name string
+	}
+	var rows []Row
+	groups := map[groupKey][]int{}
+	lowest := map[scaleKey]int{}
+	for _, res := range average(results) {
+		s, _ := suiteOf(res.Package)
+		impls := s.impls
+		if opts.Impl != nil {
+			impls = []*regexp.Regexp{opts.Impl}
+		}
+		impl, group := splitImpl(res.Name, impls)
+		rows = append(rows, Row{
+			Package:     res.Package,
+			Name:        res.Name,
+			Impl:        impl,
+			Procs:       res.Procs,
+			NsPerOp:     res.Metrics["ns/op"],
+			BytesPerOp:  res.Metrics["B/op"],
+			AllocsPerOp: res.Metrics["allocs/op"],
+			P99:         res.Metrics["p99-ns"],
+			MutexWait:   res.Metrics["mutex-wait-ns/op"],
+		})
+		if impl != "" {
+			k := groupKey{res.Package, group, res.Procs}
+			groups[k] = append(groups[k], len(rows)-1)
+		}
+		sk := scaleKey{res.Package, res.Name}
+		if idx, ok := lowest[sk]; !ok || res.Procs < rows[idx].Procs {
+			lowest[sk] = len(rows) - 1
+		}
+	}
+
+	for k, members := range groups {
+		baseline := opts.Baseline
+		if baseline == "" {
+			s, _ := suiteOf(k.pkg)
+			baseline = s.baseline
+		}
+		ref := -1
+		for _, idx := range members {
+			if rows[idx].Impl == baseline {
+				ref = idx
+				break
+			}
+			if ref < 0 || rows[idx].NsPerOp > rows[ref].NsPerOp {
+				ref = idx
+			}
+		}
+		for _, idx := range members {
+			if rows[idx].NsPerOp > 0 {
+				rows[idx].Speedup = rows[ref].NsPerOp / rows[idx].NsPerOp
+			}
+		}
+	}
+	for i := range rows {
+		ref := rows[lowest[scaleKey{rows[i].Package, rows[i].Name}]]
+		if ref.Procs != rows[i].Procs && rows[i].NsPerOp > 0 {
+			rows[i].Scaling = ref.NsPerOp / rows[i].NsPerOp
+		}
+	}
+	return rows
+}
+
+// Format is an output format of the tables
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatCSV      Format = "csv"
+	FormatJSON     Format = "json"
+)
+
+// ParseFormat returns the format of a name (`md` is an alias of `markdown`)
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "md":
+		return FormatMarkdown, nil
+	case FormatMarkdown, FormatCSV, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (markdown, csv or json)", name)
+}
+
+// table is a table with a header, written in any format
+type table struct {
+	header []string
+	rows   [][]string
+	values any // written instead of the rows in JSON
+}
+
+func (t table) write(w io.Writer, f Format) error {
+	switch f {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t.values)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(t.header)
+		cw.WriteAll(t.rows)
+		return cw.Error()
+	}
+	var sb strings.Builder
+	sb.WriteString("| " + strings.Join(t.header, " | ") + " |\n")
+	sb.WriteString(strings.Repeat("| --- ", len(t.header)) + "|\n")
+	for _, row := range t.rows {
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteReport writes the rows of a report
+func WriteReport(w io.Writer, rows []Row, f Format) error {
+	t := table{
+		header: []string{"package", "benchmark", "impl", "procs", "ns/op", "B/op", "allocs/op", "p99-ns", "mutex-wait-ns/op", "speedup", "scaling"},
+		values: rows,
+	}
+	for _, r := range rows {
+		t.rows = append(t.rows, []string{
+			r.Package, r.Name, r.Impl, strconv.Itoa(r.Procs),
+			formatFloat(r.NsPerOp), formatFloat(r.BytesPerOp), formatFloat(r.AllocsPerOp),
+			formatFloat(r.P99), formatFloat(r.MutexWait), formatRatio(r.Speedup), formatRatio(r.Scaling),
+		})
+	}
+	return t.write(w, f)
+}
+
+func formatFloat(v float64) string {
+	if v >= 100 {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatRatio(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64) + "x"
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleRun = `goos: linux
+goarch: amd64
+pkg: bench-map-access/mapaccess
+cpu: Intel(R) Xeon(R) CPU
+BenchmarkMaps/Get/LockMap/keys=100/uniform          	 1000000	       100.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkMaps/Get/LockMap/keys=100/uniform-4        	 1000000	       200.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkMaps/Get/ShardedMap/keys=100/uniform       	 1000000	        50.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkMaps/Get/ShardedMap/keys=100/uniform-4     	 1000000	        25.0 ns/op	         3.5 mutex-wait-ns/op	        24.0 p50-ns	        96.0 p99-ns	       0 B/op	       0 allocs/op
+BenchmarkBoxing/SyncMap/boxed-4                     	 1000000	        80.0 ns/op	      16 B/op	       2 allocs/op
+BenchmarkBoxing/SyncMap/boxed-4                     	 1000000	       120.0 ns/op	      16 B/op	       2 allocs/op
+PASS
+ok  	bench-map-access/mapaccess	1.234s
+`
+
+func TestParseResults(t *testing.T) {
+	results, err := ParseResults(strings.NewReader(sampleRun))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+	res := results[1]
+	if res.Package != "bench-map-access/mapaccess" || res.Name != "BenchmarkMaps/Get/LockMap/keys=100/uniform" || res.Procs != 4 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.Iterations != 1000000 || res.Metrics["ns/op"] != 200 || res.Metrics["allocs/op"] != 0 {
+		t.Fatalf("unexpected metrics %+v", res)
+	}
+	if results[0].Procs != 1 {
+		t.Fatalf("expected GOMAXPROCS 1 without suffix, got %d", results[0].Procs)
+	}
+}
+
+func TestReport(t *testing.T) {
+	results, _ := ParseResults(strings.NewReader(sampleRun))
+	rows := Report(results, ReportOptions{})
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows (the -count runs are averaged), got %d", len(rows))
+	}
+	byName := map[string]Row{}
+	for _, r := range rows {
+		byName[r.Impl+"-"+string(rune('0'+r.Procs))] = r
+	}
+	if r := byName["ShardedMap-4"]; r.Speedup != 8 || r.Scaling != 2 {
+		t.Fatalf("expected a speedup of 8x over the LockMap and a scaling of 2x, got %+v", r)
+	}
+	if r := byName["ShardedMap-4"]; r.P99 != 96 || r.MutexWait != 3.5 {
+		t.Fatalf("expected the latency and the mutex wait metrics, got %+v", r)
+	}
+	if r := byName["LockMap-1"]; r.Speedup != 1 || r.Scaling != 0 {
+		t.Fatalf("expected the baseline with a speedup of 1x, got %+v", r)
+	}
+	if r := byName["SyncMap-4"]; r.NsPerOp != 100 || r.AllocsPerOp != 2 {
+		t.Fatalf("expected the average of the runs, got %+v", r)
+	}
+
+	for _, f := range []Format{FormatMarkdown, FormatCSV, FormatJSON} {
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, rows, f); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "ShardedMap") {
+			t.Fatalf("%s: expected the implementations in the report, got %s", f, buf.String())
+		}
+	}
+}
+
+func TestSplitImpl(t *testing.T) {
+	cases := []struct {
+		pkg, name, impl, group string
+	}{
+		{"bench-map-access/mapaccess", "BenchmarkMaps/Get/COWMap/keys=100/uniform", "COWMap", "BenchmarkMaps/Get/*/keys=100/uniform"},
+		{"bench-map-access/mapaccess", "BenchmarkWriteRatio/SyncMap/writes=1%", "SyncMap", "BenchmarkWriteRatio/*/writes=1%"},
+		{"app/ipfirewall", "BenchmarkParallelContextAndUpdate", "Context", "BenchmarkParallel*AndUpdate"},
+		{"app/ipfirewall", "BenchmarkParallelSharedMutexCounter", "SharedMutex", "BenchmarkParallel*Counter"},
+		{"app/ipfirewall", "BenchmarkDecide", "", "BenchmarkDecide"},
+	}
+	for _, c := range cases {
+		s, _ := suiteOf(c.pkg)
+		impl, group := splitImpl(c.name, s.impls)
+		if impl != c.impl || group != c.group {
+			t.Fatalf("%s: expected %q and %q, got %q and %q", c.name, c.impl, c.group, impl, group)
+		}
+	}
+}
+
+func TestInModule(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "suite", "pkg")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if inModule(sub) {
+		t.Fatalf("%s: expected no module", sub)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "suite", "go.mod"), []byte("module suite\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !inModule(sub) {
+		t.Fatalf("%s: expected the module of its parent", sub)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, _ := ParseResults(strings.NewReader(sampleRun))
+	saved := strings.NewReplacer("       200.0 ns/op", "       230.0 ns/op", "        25.0 ns/op", "        20.0 ns/op").Replace(sampleRun)
+	new, err := LoadResults(strings.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := Diff(old, new, 10)
+	if n := Regressions(rows); n != 1 {
+		t.Fatalf("expected 1 regression, got %d", n)
+	}
+	for _, r := range rows {
+		switch {
+		case r.Name == "BenchmarkMaps/Get/LockMap/keys=100/uniform" && r.Procs == 4:
+			if !r.Regression || r.Delta != 15 {
+				t.Fatalf("expected a regression of 15%%, got %+v", r)
+			}
+		case r.Name == "BenchmarkMaps/Get/ShardedMap/keys=100/uniform" && r.Procs == 4:
+			if !r.Improvement {
+				t.Fatalf("expected an improvement, got %+v", r)
+			}
+		case r.Regression || r.Improvement:
+			t.Fatalf("expected no change, got %+v", r)
+		}
+	}
+}
+
+func TestDiffAllocsAndMissing(t *testing.T) {
+	old, _ := ParseResults(strings.NewReader(sampleRun))
+	lines := strings.Split(sampleRun, "\n")
+	lines = append(lines[:4], lines[5:]...) // BenchmarkMaps/Get/LockMap/keys=100/uniform is missing
+	saved := strings.NewReplacer("       2 allocs/op", "       3 allocs/op").Replace(strings.Join(lines, "\n"))
+	new, err := ParseResults(strings.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 to 3 allocs/op is a growth of 50%
+	for _, tc := range []struct {
+		threshold   float64
+		regressions int
+	}{{10, 1}, {60, 0}} {
+		rows := Diff(old, new, tc.threshold)
+		if n := Regressions(rows); n != tc.regressions {
+			t.Fatalf("expected %d regression(s) with a threshold of %g%%, got %d", tc.regressions, tc.threshold, n)
+		}
+		last := rows[len(rows)-1]
+		if Missing(rows) != 1 || !last.Missing || last.Name != "BenchmarkMaps/Get/LockMap/keys=100/uniform" || last.Procs != 1 {
+			t.Fatalf("expected the missing benchmark in the last row, got %+v", rows)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, Diff(old, new, 10), FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "MISSING") {
+		t.Fatalf("expected the missing benchmark in the diff, got %s", buf.String())
+	}
+}
+
+// TestAllocsRegressed checks that a growth of less than one allocation per operation is ignored.
+func TestAllocsRegressed(t *testing.T) {
+	for _, tc := range []struct {
+		old, new float64
+		expected bool
+	}{
+		{0, 0.5, false},
+		{0, 1, true},
+		{10, 10.9, false},
+		{10, 11, false},
+		{10, 12, true},
+		{2, 1, false},
+	} {
+		if found := allocsRegressed(tc.old, tc.new, 10); found != tc.expected {
+			t.Fatalf("expected %t for %g to %g allocs/op, got %t", tc.expected, tc.old, tc.new, found)
+		}
+	}
+}
+
+func TestLoadResultsJSON(t *testing.T) {
+	results, _ := ParseResults(strings.NewReader(sampleRun))
+	var buf bytes.Buffer
+	if err := (table{values: results}).write(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadResults(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(results) || loaded[3].Metrics["ns/op"] != 25 {
+		t.Fatalf("expected the saved results, got %+v", loaded)
+	}
+}
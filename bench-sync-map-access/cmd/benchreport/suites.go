@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// suite is a benchmark suite of the repository. The implementation of a benchmark is the `impl` group of the first
+// matching pattern and the benchmarks that only differ by their implementation are compared (see Report).
+type suite struct {
+	dir      string // relative to bench-sync-map-access
+	impls    []*regexp.Regexp
+	baseline string // implementation of reference for the speedups, the slowest implementation if empty
+}
+
+var suites = map[string]suite{
+	"mapaccess": {
+		dir:      "mapaccess",
+		impls:    []*regexp.Regexp{regexp.MustCompile(`/(?P<impl>[A-Za-z]+Map)(?:/|$)`)},
+		baseline: "LockMap",
+	},
+	// the firewall has no go.mod in the repository (its Dockerfile creates it), so it is not run by default
+	"ipfirewall": {
+		dir: "../benchmark-ip-firewall-updates/ipfirewall",
+		impls: []*regexp.Regexp{
+			regexp.MustCompile(`^Benchmark(?:Parallel)?(?P<impl>ReadVersion|ReadEventuallyConsistentVersion|Uint64Struct|Uint64Function|IPListPointer|Context|RWMutex|Mutex)(?:AndUpdate)?$`),
+			regexp.MustCompile(`^BenchmarkParallel(?P<impl>Sharded|SharedAtomic|SharedMutex)Counter$`),
+		},
+	},
+}
+
+// suiteOf returns the suite of a package (by the last element of its import path)
+func suiteOf(pkg string) (suite, bool) {
+	s, ok := suites[path.Base(pkg)]
+	return s, ok
+}
+
+// splitImpl returns the implementation of a benchmark and its name without the implementation,
+// which is the same for all the implementations of a comparison (e.g. `BenchmarkMaps/Get/*/keys=100/uniform`).
+func splitImpl(name string, impls []*regexp.Regexp) (impl, group string) {
+	for _, re := range impls {
+		m := re.FindStringSubmatchIndex(name)
+		idx := re.SubexpIndex("impl")
+		if m == nil || idx < 0 || m[2*idx] < 0 {
+			continue
+		}
+		start, end := m[2*idx], m[2*idx+1]
+		return name[start:end], name[:start] + "*" + name[end:]
+	}
+	return "", name
+}
+
+// inModule reports whether a directory is in a Go module or a workspace (a go.mod or a go.work in the directory
+// or one of its parents), so that `go test` can run in it
+func inModule(dir string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for {
+		for _, file := range []string{"go.mod", "go.work"} {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				return true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,95 @@
+package mapaccess
+
+import "iter"
+
+// Map is the interface implemented by all the maps of the benchmarks.
+type Map[K comparable, V any] interface {
+	// Get retrieves a value from the map by key.
+	Get(key K) (V, bool)
+	// Set sets a key-value pair in the map.
+	Set(key K, value V)
+	// Delete removes a key-value pair from the map.
+	Delete(key K)
+
+	// LoadOrStore returns the existing value of a key (loaded is true) or stores and returns the given value.
+	LoadOrStore(key K, value V) (actual V, loaded bool)
+	// CompareAndSwap swaps the value of a key if it is equal to old. It panics if V is not comparable.
+	CompareAndSwap(key K, old, new V) (swapped bool)
+	// CompareAndDelete deletes a key if its value is equal to old. It panics if V is not comparable.
+	CompareAndDelete(key K, old V) (deleted bool)
+	// Update atomically replaces the value of a key with the result of fn and returns the new value.
+	// ok is false if the key is not in the map (old is the zero value). fn may be called with a lock held,
+	// so it must not use the map, and it may be called more than once (SyncMap). V does not need to be comparable.
+	Update(key K, fn func(old V, ok bool) V) V
+	// Range calls f for every key-value pair until f returns false, with the consistency of All.
+	// f is never called with a lock held, so it may read and write the map.
+	Range(f func(key K, value V) bool)
+	// Len returns the number of keys in the map.
+	Len() int
+
+	// All returns an iterator over the key-value pairs of the map. The loop body may use the map. Every implementation
+	// documents whether the iteration is a snapshot (the writes during the iteration are not seen) or weakly
+	// consistent (every key present during the whole iteration is seen once, the writes may or may not be seen).
+	All() iter.Seq2[K, V]
+	// Keys returns an iterator over the keys of the map, with the consistency of All.
+	Keys() iter.Seq[K]
+	// Values returns an iterator over the values of the map, with the consistency of All.
+	Values() iter.Seq[V]
+}
+
+var (
+	_ Map[string, any] = (*LockMap[string, any])(nil)
+	_ Map[string, any] = (*RWLockMap[string, any])(nil)
+	_ Map[string, any] = (*SyncMap[string, any])(nil)
+	_ Map[string, any] = (*ShardedMap[string, any])(nil)
+	_ Map[string, any] = (*TTLMap[string, any])(nil)
+	_ Map[string, any] = (*LRUMap[string, any])(nil)
+	_ Map[string, any] = (*COWMap[string, any])(nil)
+)
+
+// equal compares two values of a type parameter (like sync.Map, it panics if the values are not comparable).
+func equal[V any](a, b V) bool {
+	return any(a) == any(b)
+}
+
+// keysOf returns an iterator over the keys of an iterator of key-value pairs.
+func keysOf[K, V any](all iter.Seq2[K, V]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range all {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// valuesOf returns an iterator over the values of an iterator of key-value pairs.
+func valuesOf[K, V any](all iter.Seq2[K, V]) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, val := range all {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// rangeAll calls f for every key-value pair of an iterator until f returns false.
+func rangeAll[K, V any](all iter.Seq2[K, V], f func(key K, value V) bool) {
+	for key, val := range all {
+		if !f(key, val) {
+			return
+		}
+	}
+}
+
+// mapAll returns an iterator over a map that is not modified during the iteration.
+func mapAll[K comparable, V any](data map[K]V) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, val := range data {
+			if !yield(key, val) {
+				return
+			}
+		}
+	}
+}
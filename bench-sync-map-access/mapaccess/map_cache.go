@@ -0,0 +1,580 @@
+package mapaccess
+
+import (
+	"hash/maphash"
+	"io"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionReason is the reason why a cache removed an entry.
+type EvictionReason int
+
+const (
+	EvictionExpired  EvictionReason = iota // the time to live of the entry has passed
+	EvictionCapacity                       // the entry was the least recently used entry of a full cache
+)
+
+func (r EvictionReason) String() string {
+	return [...]string{"expired", "capacity"}[r]
+}
+
+// CacheOptions are the options of the TTLMap and the LRUMap.
+type CacheOptions[K comparable, V any] struct {
+	// Shards is the number of shards. With 1 shard (or 0) the cache has a single lock like the LockMap, with more
+	// shards (rounded up to a power of two) it is split like the ShardedMap.
+	Shards int
+	// CleanupInterval is the interval of the background removal of the expired entries of a TTLMap
+	// (the TTL by default, or a minute without TTL). Expired entries are also removed when they are read.
+	CleanupInterval time.Duration
+	// OnEvict is called when an entry expires or is evicted (but not on Delete). It is called with the lock of the
+	// shard held, so it must not use the cache.
+	OnEvict func(key K, value V, reason EvictionReason)
+	// Now returns the current time to expire the entries (time.Now by default), e.g. a fake clock in the tests.
+	Now func() time.Time
+}
+
+// CacheStats are the counters of a cache.
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64 // entries removed because the cache was full
+	Expirations uint64 // entries removed because they expired
+}
+
+// TTLMap is a map where every entry expires after a time to live.
+// Expired entries are never returned: they are removed when they are read and by a background goroutine
+// (stopped by Close).
+type TTLMap[K comparable, V any] struct {
+	*cache[K, V]
+}
+
+// defaultCleanupInterval is the interval of the background removal of a TTLMap without TTL, whose entries only
+// expire with SetWithTTL.
+const defaultCleanupInterval = time.Minute
+
+// NewTTLMap creates and returns a new TTLMap where entries expire after ttl (see SetWithTTL).
+// With a ttl of 0, the entries never expire unless they are set with SetWithTTL.
+func NewTTLMap[K comparable, V any](ttl time.Duration, opts CacheOptions[K, V]) *TTLMap[K, V] {
+	c := newCache(opts)
+	c.ttl = ttl
+	c.expiring = true
+	interval := opts.CleanupInterval
+	if interval <= 0 {
+		interval = ttl
+	}
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	c.startJanitor(interval)
+	return &TTLMap[K, V]{c}
+}
+
+// SetWithTTL sets a key-value pair that expires after ttl instead of the ttl of the map.
+func (m *TTLMap[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	m.set(s, key, value, m.clock().Add(ttl).UnixNano())
+}
+
+// LRUMap is a map with a maximum number of entries. When it is full, the least recently used entry is evicted.
+// A sharded LRUMap splits the capacity between the shards, so the evicted entry is the least recently used
+// entry of its shard. The capacities of the shards add up to the capacity (a map has at most as many shards as
+// its capacity).
+type LRUMap[K comparable, V any] struct {
+	*cache[K, V]
+}
+
+// NewLRUMap creates and returns a new LRUMap with a maximum number of entries.
+func NewLRUMap[K comparable, V any](capacity int, opts CacheOptions[K, V]) *LRUMap[K, V] {
+	capacity = max(1, capacity)
+	n := shardCount(opts.Shards)
+	for n > capacity {
+		n >>= 1 // every shard holds at least one entry
+	}
+	opts.Shards = n
+	c := newCache(opts)
+	c.lru = true
+	for i := range c.shards {
+		c.shards[i].capacity = capacity / n
+		if i < capacity%n {
+			c.shards[i].capacity++
+		}
+	}
+	return &LRUMap[K, V]{c}
+}
+
+// cache is the implementation of the TTLMap and the LRUMap. The entries of a shard are in a map and in a list
+// ordered from the most recently used to the least recently used entry.
+type cache[K comparable, V any] struct {
+	seed     maphash.Seed
+	mask     uint64
+	shards   []cacheShard[K, V]
+	ttl      time.Duration // default ttl of the entries, 0 if they never expire by default
+	expiring bool          // the entries may expire (TTLMap), with the default ttl or with SetWithTTL
+	lru      bool
+	onEvict  func(key K, value V, reason EvictionReason)
+	clock    func() time.Time
+
+	stop      chan struct{}
+	stopOnce  sync.Once
+	janitorWg sync.WaitGroup
+}
+
+type cacheShard[K comparable, V any] struct {
+	sync.RWMutex
+	items      map[K]*cacheEntry[K, V]
+	head, tail *cacheEntry[K, V] // most and least recently used entries (LRUMap only)
+	capacity   int               // maximum number of entries of the shard (LRUMap only)
+
+	hits, misses, evictions, expirations atomic.Uint64
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key        K
+	value      V
+	expires    int64 // unix nanoseconds, 0 if the entry never expires
+	prev, next *cacheEntry[K, V]
+}
+
+// shardCount rounds a number of shards up to a power of two (at least 1).
+func shardCount(shards int) int {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	return n
+}
+
+func newCache[K comparable, V any](opts CacheOptions[K, V]) *cache[K, V] {
+	n := shardCount(opts.Shards)
+	c := &cache[K, V]{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(n - 1),
+		shards:  make([]cacheShard[K, V], n),
+		onEvict: opts.OnEvict,
+		clock:   opts.Now,
+		stop:    make(chan struct{}),
+	}
+	if c.clock == nil {
+		c.clock = time.Now
+	}
+	for i := range c.shards {
+		c.shards[i].items = make(map[K]*cacheEntry[K, V])
+	}
+	return c
+}
+
+func (c *cache[K, V]) shard(key K) *cacheShard[K, V] {
+	return &c.shards[maphash.Comparable(c.seed, key)&c.mask]
+}
+
+// expiry returns the expiry time of a new entry.
+func (c *cache[K, V]) expiry() int64 {
+	if c.ttl <= 0 {
+		return 0
+	}
+	return c.clock().Add(c.ttl).UnixNano()
+}
+
+// now returns the current time to check the expiry of the entries (0 if the entries never expire).
+// The expiry of an entry is its own expiry time, so the entries of SetWithTTL expire without a default ttl.
+func (c *cache[K, V]) now() int64 {
+	if !c.expiring {
+		return 0
+	}
+	return c.clock().UnixNano()
+}
+
+func (e *cacheEntry[K, V]) expired(now int64) bool {
+	return e.expires != 0 && now >= e.expires
+}
+
+// Get retrieves a value from the map by key.
+func (c *cache[K, V]) Get(key K) (V, bool) {
+	s := c.shard(key)
+	if c.lru {
+		s.Lock() // a read moves the entry to the front of the list
+		defer s.Unlock()
+		return c.get(s, key, c.now())
+	}
+
+	now := c.now()
+	s.RLock()
+	e, ok := s.items[key]
+	if ok && !e.expired(now) {
+		val := e.value
+		s.RUnlock()
+		s.hits.Add(1)
+		return val, true
+	}
+	s.RUnlock()
+	if !ok {
+		s.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	// the entry expired: remove it
+	s.Lock()
+	defer s.Unlock()
+	return c.get(s, key, now)
+}
+
+// get reads an entry with the lock held, removes it if it has expired and counts the hit or the miss.
+func (c *cache[K, V]) get(s *cacheShard[K, V], key K, now int64) (V, bool) {
+	e, ok := c.lookup(s, key, now)
+	if !ok {
+		s.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	s.hits.Add(1)
+	return e.value, true
+}
+
+// lookup returns the entry of a key with the lock held. Expired entries are removed and
+// the entries of an LRUMap are moved to the front of the list.
+func (c *cache[K, V]) lookup(s *cacheShard[K, V], key K, now int64) (*cacheEntry[K, V], bool) {
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(now) {
+		c.evict(s, e, EvictionExpired)
+		return nil, false
+	}
+	if c.lru {
+		s.moveToFront(e)
+	}
+	return e, true
+}
+
+// set inserts or replaces an entry with the lock held and evicts the least recently used entry of a full LRUMap.
+func (c *cache[K, V]) set(s *cacheShard[K, V], key K, value V, expires int64) {
+	if e, ok := s.items[key]; ok {
+		e.value, e.expires = value, expires
+		if c.lru {
+			s.moveToFront(e)
+		}
+		return
+	}
+	e := &cacheEntry[K, V]{key: key, value: value, expires: expires}
+	s.items[key] = e
+	if c.lru {
+		s.pushFront(e)
+		if len(s.items) > s.capacity {
+			c.evict(s, s.tail, EvictionCapacity)
+		}
+	}
+}
+
+// remove removes an entry with the lock held.
+func (c *cache[K, V]) remove(s *cacheShard[K, V], e *cacheEntry[K, V]) {
+	delete(s.items, e.key)
+	if c.lru {
+		s.unlink(e)
+	}
+}
+
+// evict removes an entry with the lock held, counts it and calls the eviction callback.
+func (c *cache[K, V]) evict(s *cacheShard[K, V], e *cacheEntry[K, V], reason EvictionReason) {
+	c.remove(s, e)
+	if reason == EvictionExpired {
+		s.expirations.Add(1)
+	} else {
+		s.evictions.Add(1)
+	}
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value, reason)
+	}
+}
+
+// Set sets a key-value pair in the map.
+func (c *cache[K, V]) Set(key K, value V) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	c.set(s, key, value, c.expiry())
+}
+
+// Delete removes a key-value pair from the map.
+func (c *cache[K, V]) Delete(key K) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.items[key]; ok {
+		c.remove(s, e)
+	}
+}
+
+// LoadOrStore returns the existing value of a key or stores and returns the given value.
+func (c *cache[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if val, ok := c.get(s, key, c.now()); ok {
+		return val, true
+	}
+	c.set(s, key, value, c.expiry())
+	return value, false
+}
+
+// CompareAndSwap swaps the value of a key if it is equal to old.
+func (c *cache[K, V]) CompareAndSwap(key K, old, new V) bool {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := c.lookup(s, key, c.now())
+	if !ok || !equal(e.value, old) {
+		return false
+	}
+	c.set(s, key, new, c.expiry())
+	return true
+}
+
+// CompareAndDelete deletes a key if its value is equal to old.
+func (c *cache[K, V]) CompareAndDelete(key K, old V) bool {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := c.lookup(s, key, c.now())
+	if !ok || !equal(e.value, old) {
+		return false
+	}
+	c.remove(s, e)
+	return true
+}
+
+// Update replaces the value of a key with the result of fn (an expired key is missing) and resets its time to live.
+// fn is called with the lock of the shard held, so it must not use the map.
+func (c *cache[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	var old V
+	e, ok := c.lookup(s, key, c.now())
+	if ok {
+		old = e.value
+	}
+	val := fn(old, ok)
+	c.set(s, key, val, c.expiry())
+	return val
+}
+
+// Range calls f for every entry that has not expired until f returns false, with the consistency of All.
+// f is never called with a lock held, so it may use the map. Range does not change the order of the entries
+// of an LRUMap.
+func (c *cache[K, V]) Range(f func(key K, value V) bool) {
+	rangeAll(c.All(), f)
+}
+
+// All returns an iterator over the entries that have not expired, one shard after the other. Every shard is copied
+// with its read lock held when the iteration reaches it, so the iteration is a snapshot of a cache with a single
+// shard and weakly consistent with more shards. It does not change the order of the entries of an LRUMap.
+func (c *cache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		now := c.now()
+		for i := range c.shards {
+			s := &c.shards[i]
+			s.RLock()
+			entries := make([]snapshotEntry[K, V], 0, len(s.items))
+			for _, e := range s.items {
+				entries = e.appendTo(entries, now)
+			}
+			s.RUnlock()
+			for _, e := range entries {
+				if !yield(e.Key, e.Value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the entries that have not expired, with the consistency of All.
+func (c *cache[K, V]) Keys() iter.Seq[K] {
+	return keysOf(c.All())
+}
+
+// Values returns an iterator over the values of the entries that have not expired, with the consistency of All.
+func (c *cache[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
+
+// Len returns the number of entries in the map, including the expired entries that are not removed yet.
+func (c *cache[K, V]) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.RLock()
+		n += len(s.items)
+		s.RUnlock()
+	}
+	return n
+}
+
+// Stats returns the hits, misses, evictions and expirations of the map.
+func (c *cache[K, V]) Stats() CacheStats {
+	var stats CacheStats
+	for i := range c.shards {
+		s := &c.shards[i]
+		stats.Hits += s.hits.Load()
+		stats.Misses += s.misses.Load()
+		stats.Evictions += s.evictions.Load()
+		stats.Expirations += s.expirations.Load()
+	}
+	return stats
+}
+
+// Snapshot writes a point-in-time snapshot of the entries that have not expired, with their expiry time.
+// The entries are copied with the read locks of all the shards held and written without them. The entries of an
+// LRUMap are written from the least to the most recently used entry of every shard, so Restore keeps their order.
+func (c *cache[K, V]) Snapshot(w io.Writer) error {
+	for i := range c.shards {
+		c.shards[i].RLock()
+	}
+	now := c.now()
+	var entries []snapshotEntry[K, V]
+	for i := range c.shards {
+		s := &c.shards[i]
+		if c.lru {
+			for e := s.tail; e != nil; e = e.prev {
+				entries = e.appendTo(entries, now)
+			}
+			continue
+		}
+		for _, e := range s.items {
+			entries = e.appendTo(entries, now)
+		}
+	}
+	for i := range c.shards {
+		c.shards[i].RUnlock()
+	}
+	return writeSnapshot(w, len(entries), slices.Values(entries))
+}
+
+func (e *cacheEntry[K, V]) appendTo(entries []snapshotEntry[K, V], now int64) []snapshotEntry[K, V] {
+	if e.expired(now) {
+		return entries
+	}
+	return append(entries, snapshotEntry[K, V]{Key: e.key, Value: e.value, Expires: e.expires})
+}
+
+// Restore replaces the entries of the map with a snapshot. The entries keep their expiry time (the expired entries
+// are skipped) and the entries of a snapshot of a map without expiry get the ttl of a TTLMap. An LRUMap evicts the
+// entries over its capacity. All the shards are locked while the entries are inserted.
+func (c *cache[K, V]) Restore(r io.Reader) error {
+	entries, err := readSnapshot[K, V](r)
+	if err != nil {
+		return err
+	}
+	for i := range c.shards {
+		c.shards[i].Lock()
+	}
+	defer func() {
+		for i := range c.shards {
+			c.shards[i].Unlock()
+		}
+	}()
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.items = make(map[K]*cacheEntry[K, V])
+		s.head, s.tail = nil, nil
+	}
+	for _, e := range entries {
+		expires := e.Expires
+		if !c.expiring {
+			expires = 0
+		} else if expires == 0 {
+			expires = c.expiry()
+		}
+		c.set(c.shard(e.Key), e.Key, e.Value, expires)
+	}
+	return nil
+}
+
+// RemoveExpired removes the expired entries and returns their number. It is called by the background goroutine.
+func (c *cache[K, V]) RemoveExpired() int {
+	if !c.expiring {
+		return 0
+	}
+	removed := 0
+	now := c.now()
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.Lock()
+		for _, e := range s.items {
+			if e.expired(now) {
+				c.evict(s, e, EvictionExpired)
+				removed++
+			}
+		}
+		s.Unlock()
+	}
+	return removed
+}
+
+// Close stops the background removal of the expired entries. The map can still be used.
+func (c *cache[K, V]) Close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.janitorWg.Wait()
+}
+
+func (c *cache[K, V]) startJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.janitorWg.Add(1)
+	go func() {
+		defer c.janitorWg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.RemoveExpired()
+			}
+		}
+	}()
+}
+
+// The LRU list of a shard (with the lock held).
+
+func (s *cacheShard[K, V]) pushFront(e *cacheEntry[K, V]) {
+	e.prev, e.next = nil, s.head
+	if s.head != nil {
+		s.head.prev = e
+	}
+	s.head = e
+	if s.tail == nil {
+		s.tail = e
+	}
+}
+
+func (s *cacheShard[K, V]) unlink(e *cacheEntry[K, V]) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		s.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		s.tail = e.prev
+	}
+	e.prev, e.next = nil, nil
+}
+
+func (s *cacheShard[K, V]) moveToFront(e *cacheEntry[K, V]) {
+	if s.head == e {
+		return
+	}
+	s.unlink(e)
+	s.pushFront(e)
+}
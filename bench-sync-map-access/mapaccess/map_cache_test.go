@@ -0,0 +1,212 @@
+package mapaccess
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// evictions records the calls of an eviction callback.
+type evictions struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (e *evictions) onEvict(key string, value int, reason EvictionReason) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys = append(e.keys, key+":"+reason.String())
+}
+
+func (e *evictions) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.keys...)
+}
+
+// fakeClock is the clock of the caches whose expiry is tested without sleeping.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestTTLMapLazyExpiry(t *testing.T) {
+	var ev evictions
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	// the background removal never runs during the test
+	m := NewTTLMap(20*time.Millisecond, CacheOptions[string, int]{CleanupInterval: time.Hour, OnEvict: ev.onEvict, Now: clock.now})
+	defer m.Close()
+
+	m.Set("a", 1)
+	m.SetWithTTL("b", 2, time.Hour)
+	if val, ok := m.Get("a"); !ok || val != 1 {
+		t.Fatalf("expected 1, got %d (%t)", val, ok)
+	}
+	clock.advance(20 * time.Millisecond)
+
+	if _, ok := m.Get("a"); ok {
+		t.Fatalf("expected a to be expired")
+	}
+	if val, ok := m.Get("b"); !ok || val != 2 {
+		t.Fatalf("expected 2, got %d (%t)", val, ok)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected 1 key, got %d", m.Len())
+	}
+	if keys := ev.get(); len(keys) != 1 || keys[0] != "a:expired" {
+		t.Fatalf("expected the eviction of a, got %v", keys)
+	}
+	if stats := m.Stats(); stats != (CacheStats{Hits: 2, Misses: 1, Expirations: 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// an expired key is missing for the other operations
+	m.SetWithTTL("c", 3, time.Nanosecond)
+	clock.advance(time.Nanosecond)
+	if val, loaded := m.LoadOrStore("c", 4); loaded || val != 4 {
+		t.Fatalf("expected to store 4, got %d (loaded %t)", val, loaded)
+	}
+}
+
+// TestTTLMapWithoutTTL checks that the entries of SetWithTTL expire in a map without a default ttl.
+func TestTTLMapWithoutTTL(t *testing.T) {
+	m := NewTTLMap(0, CacheOptions[string, int]{Shards: 4, CleanupInterval: 5 * time.Millisecond})
+	defer m.Close()
+	m.Set("a", 1)
+	m.SetWithTTL("b", 2, time.Millisecond)
+	m.SetWithTTL("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := m.Get("b"); ok {
+		t.Fatalf("expected b to be expired")
+	}
+	// c is removed by the background goroutine
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if val, ok := m.Get("a"); !ok || val != 1 || m.Len() != 1 {
+		t.Fatalf("expected only a, got %d (%t) and %d keys", val, ok, m.Len())
+	}
+}
+
+func TestTTLMapBackgroundExpiry(t *testing.T) {
+	var ev evictions
+	m := NewTTLMap(10*time.Millisecond, CacheOptions[string, int]{Shards: 4, CleanupInterval: 5 * time.Millisecond, OnEvict: ev.onEvict})
+	defer m.Close()
+	for i := 0; i < 100; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m.Len() != 0 || len(ev.get()) != 100 || m.Stats().Expirations != 100 {
+		t.Fatalf("expected 100 expired keys, got %d keys left and %d evictions", m.Len(), len(ev.get()))
+	}
+
+	m.Close() // Close can be called twice
+}
+
+func TestLRUMapEviction(t *testing.T) {
+	var ev evictions
+	m := NewLRUMap(3, CacheOptions[string, int]{OnEvict: ev.onEvict})
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	m.Get("a")    // b is now the least recently used key
+	m.Set("d", 4) // evicts b
+	m.Set("c", 5) // c is used again: evicts a on the next insert
+	m.Set("e", 6)
+
+	if keys := ev.get(); len(keys) != 2 || keys[0] != "b:capacity" || keys[1] != "a:capacity" {
+		t.Fatalf("expected the eviction of b and a, got %v", keys)
+	}
+	for key, expected := range map[string]int{"c": 5, "d": 4, "e": 6} {
+		if val, ok := m.Get(key); !ok || val != expected {
+			t.Fatalf("expected %d for %s, got %d (%t)", expected, key, val, ok)
+		}
+	}
+	if _, ok := m.Get("b"); ok || m.Len() != 3 {
+		t.Fatalf("expected 3 keys without b, got %d", m.Len())
+	}
+	if stats := m.Stats(); stats != (CacheStats{Hits: 4, Misses: 1, Evictions: 2}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// deleted keys are not evictions
+	m.Delete("c")
+	if m.CompareAndDelete("d", 4); m.Len() != 1 || len(ev.get()) != 2 {
+		t.Fatalf("expected 1 key and 2 evictions, got %d keys and %v", m.Len(), ev.get())
+	}
+}
+
+func TestShardedLRUMapCapacity(t *testing.T) {
+	m := NewLRUMap(100, CacheOptions[string, int]{Shards: 4})
+	for i := 0; i < 1000; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+	// every shard holds 25 keys
+	if m.Len() != 100 || m.Stats().Evictions != 900 {
+		t.Fatalf("expected 100 keys and 900 evictions, got %d keys and %+v", m.Len(), m.Stats())
+	}
+}
+
+// TestShardedLRUMapSmallCapacity checks that the capacities of the shards add up to the capacity of the map,
+// also with more shards than entries.
+func TestShardedLRUMapSmallCapacity(t *testing.T) {
+	for _, tc := range []struct{ capacity, shards int }{{10, 16}, {10, 4}, {3, 4}, {1, 8}, {0, 2}} {
+		m := NewLRUMap(tc.capacity, CacheOptions[string, int]{Shards: tc.shards})
+		for i := 0; i < 1000; i++ {
+			m.Set("key-"+strconv.Itoa(i), i)
+		}
+		// every shard is full
+		if expected := max(1, tc.capacity); m.Len() != expected {
+			t.Fatalf("expected %d keys with %d shards, got %d", expected, tc.shards, m.Len())
+		}
+	}
+}
+
+// BenchmarkCacheOverhead compares a Set and a Get of the caches with the plain maps they are built on.
+func BenchmarkCacheOverhead(b *testing.B) {
+	c := benchConfig{keys: 10000}
+	k := newBenchKeys(c.keys)
+	for _, bm := range []benchMap{
+		{"LockMap", func() Map[string, any] { return NewLockMap() }},
+		{"TTLMap", func() Map[string, any] { return NewTTLMap(benchTTL, CacheOptions[string, any]{}) }},
+		{"LRUMap", func() Map[string, any] { return NewLRUMap(c.keys, CacheOptions[string, any]{}) }},
+		{"ShardedMap", func() Map[string, any] { return NewShardedMap[string, any]() }},
+		{"ShardedTTLMap", func() Map[string, any] { return NewTTLMap(benchTTL, CacheOptions[string, any]{Shards: benchShards}) }},
+		{"ShardedLRUMap", func() Map[string, any] { return NewLRUMap(2*c.keys, CacheOptions[string, any]{Shards: benchShards}) }},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			m := bm.new()
+			if closer, ok := m.(interface{ Close() }); ok {
+				defer closer.Close()
+			}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				p := newKeyPicker(c)
+				for pb.Next() {
+					i := p.next()
+					m.Set(k.keys[i], k.values[i])
+					m.Get(k.keys[i])
+				}
+			})
+		})
+	}
+}
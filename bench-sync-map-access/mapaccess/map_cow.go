@@ -0,0 +1,190 @@
+package mapaccess
+
+import (
+	"io"
+	"iter"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// COWMap is a copy-on-write map for read-mostly data: an immutable map behind an atomic.Pointer.
+// Reads never lock, every write copies the whole map (use Batch to apply several writes with a single copy).
+type COWMap[K comparable, V any] struct {
+	data atomic.Pointer[map[K]V]
+	mu   sync.Mutex // serializes the writers
+}
+
+// NewCOWMap creates and returns a new COWMap with string keys and any values.
+func NewCOWMap() *COWMap[string, any] {
+	return NewCOWMapOf[string, any]()
+}
+
+// NewCOWMapOf creates and returns a new COWMap with typed keys and values.
+func NewCOWMapOf[K comparable, V any]() *COWMap[K, V] {
+	m := &COWMap[K, V]{}
+	data := make(map[K]V)
+	m.data.Store(&data)
+	return m
+}
+
+// load returns the current immutable map.
+func (m *COWMap[K, V]) load() map[K]V {
+	return *m.data.Load()
+}
+
+// write copies the current map, applies fn and swaps the copy in if fn returns true. It returns the result of fn.
+func (m *COWMap[K, V]) write(fn func(data map[K]V) bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := maps.Clone(m.load())
+	if !fn(data) {
+		return false
+	}
+	m.data.Store(&data)
+	return true
+}
+
+// Get retrieves a value from the map by key.
+func (m *COWMap[K, V]) Get(key K) (V, bool) {
+	val, ok := m.load()[key]
+	return val, ok
+}
+
+// Set sets a key-value pair in the map.
+func (m *COWMap[K, V]) Set(key K, value V) {
+	m.write(func(data map[K]V) bool {
+		data[key] = value
+		return true
+	})
+}
+
+// Delete removes a key-value pair from the map. The map is not copied if the key is missing.
+func (m *COWMap[K, V]) Delete(key K) {
+	if _, ok := m.Get(key); !ok {
+		return
+	}
+	m.write(func(data map[K]V) bool {
+		_, ok := data[key]
+		delete(data, key)
+		return ok
+	})
+}
+
+// Batch applies several writes with a single copy of the map: fn receives a copy of the map that is swapped in
+// when fn returns. Readers see all the writes of a batch or none of them. fn must not use the COWMap.
+func (m *COWMap[K, V]) Batch(fn func(data map[K]V)) {
+	m.write(func(data map[K]V) bool {
+		fn(data)
+		return true
+	})
+}
+
+// LoadOrStore returns the existing value of a key or stores and returns the given value.
+func (m *COWMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	if val, ok := m.Get(key); ok {
+		return val, true
+	}
+	actual, loaded := value, false
+	m.write(func(data map[K]V) bool {
+		if val, ok := data[key]; ok {
+			actual, loaded = val, true
+			return false
+		}
+		data[key] = value
+		return true
+	})
+	return actual, loaded
+}
+
+// CompareAndSwap swaps the value of a key if it is equal to old.
+func (m *COWMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	if val, ok := m.Get(key); !ok || !equal(val, old) {
+		return false
+	}
+	return m.write(func(data map[K]V) bool {
+		if val, ok := data[key]; !ok || !equal(val, old) {
+			return false
+		}
+		data[key] = new
+		return true
+	})
+}
+
+// CompareAndDelete deletes a key if its value is equal to old.
+func (m *COWMap[K, V]) CompareAndDelete(key K, old V) bool {
+	if val, ok := m.Get(key); !ok || !equal(val, old) {
+		return false
+	}
+	return m.write(func(data map[K]V) bool {
+		if val, ok := data[key]; !ok || !equal(val, old) {
+			return false
+		}
+		delete(data, key)
+		return true
+	})
+}
+
+// Update replaces the value of a key with the result of fn. fn is called with the lock of the writers held,
+// so it must not write to the map.
+func (m *COWMap[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	var val V
+	m.write(func(data map[K]V) bool {
+		old, ok := data[key]
+		val = fn(old, ok)
+		data[key] = val
+		return true
+	})
+	return val
+}
+
+// Range calls f for every key-value pair of the current map. The map is immutable, so Range is a consistent
+// snapshot and f may use the COWMap (its writes are not seen by Range).
+func (m *COWMap[K, V]) Range(f func(key K, value V) bool) {
+	for key, val := range m.load() {
+		if !f(key, val) {
+			return
+		}
+	}
+}
+
+// Len returns the number of keys in the map.
+func (m *COWMap[K, V]) Len() int {
+	return len(m.load())
+}
+
+// All returns an iterator over the current map. The map is immutable, so the iteration is a snapshot that is
+// never copied.
+func (m *COWMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		mapAll(m.load())(yield)
+	}
+}
+
+// Keys returns an iterator over the keys of a snapshot of the map.
+func (m *COWMap[K, V]) Keys() iter.Seq[K] {
+	return keysOf(m.All())
+}
+
+// Values returns an iterator over the values of a snapshot of the map.
+func (m *COWMap[K, V]) Values() iter.Seq[V] {
+	return valuesOf(m.All())
+}
+
+// Snapshot writes a point-in-time snapshot of the map. The current map is immutable, so it is written without a lock.
+func (m *COWMap[K, V]) Snapshot(w io.Writer) error {
+	data := m.load()
+	return writeSnapshot(w, len(data), mapEntries(data))
+}
+
+// Restore replaces the content of the map with a snapshot. Readers see the whole snapshot or the previous map.
+func (m *COWMap[K, V]) Restore(r io.Reader) error {
+	data, err := readSnapshotMap[K, V](r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data.Store(&data)
+	return nil
+}
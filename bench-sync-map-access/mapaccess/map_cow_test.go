@@ -0,0 +1,45 @@
+package mapaccess
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCOWMapBatch checks that readers see all the writes of a batch or none of them.
+func TestCOWMapBatch(t *testing.T) {
+	m := NewCOWMapOf[string, int]()
+	var done atomic.Bool
+	var failed atomic.Int64
+	go func() {
+		defer done.Store(true)
+		for i := 1; i <= testIterations; i++ {
+			// every batch writes the same value to all the keys
+			m.Batch(func(data map[string]int) {
+				for k := 0; k < 10; k++ {
+					data["key-"+strconv.Itoa(k)] = i
+				}
+			})
+		}
+	}()
+
+	for !done.Load() {
+		first := -1
+		m.Range(func(key string, val int) bool {
+			if first == -1 {
+				first = val
+			} else if val != first {
+				failed.Add(1)
+			}
+			// writes during Range are not seen by Range
+			m.Delete("missing")
+			return true
+		})
+	}
+	if failed.Load() != 0 {
+		t.Fatalf("expected consistent batches, got %d partial batches", failed.Load())
+	}
+	if val, _ := m.Get("key-9"); val != testIterations || m.Len() != 10 {
+		t.Fatalf("expected 10 keys with %d, got %d keys with %d", testIterations, m.Len(), val)
+	}
+}
@@ -0,0 +1,128 @@
+package mapaccess
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// snapshotIterators are the maps of boxingMaps whose iterators are snapshots (the others are weakly consistent).
+var snapshotIterators = map[string]bool{"LockMap": true, "RWLockMap": true, "TTLMap": true, "LRUMap": true, "COWMap": true}
+
+func TestIterators(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			fill(m, 100)
+
+			seen := map[string]int{}
+			for key, val := range m.All() {
+				if _, ok := seen[key]; ok {
+					t.Fatalf("expected %s once", key)
+				}
+				seen[key] = val
+			}
+			if len(seen) != 100 || seen["key-42"] != 42 {
+				t.Fatalf("expected 100 keys with their values, got %d keys", len(seen))
+			}
+
+			keys, sum := 0, 0
+			for range m.Keys() {
+				keys++
+			}
+			for val := range m.Values() {
+				sum += val
+			}
+			if keys != 100 || sum != 4950 {
+				t.Fatalf("expected 100 keys and a sum of 4950, got %d keys and %d", keys, sum)
+			}
+
+			calls := 0
+			for range m.All() {
+				calls++
+				if calls == 10 {
+					break
+				}
+			}
+			if calls != 10 {
+				t.Fatalf("expected the iteration to stop after 10 keys, got %d", calls)
+			}
+		})
+	}
+}
+
+// TestIteratorsConsistency deletes and adds keys from the loop body: a snapshot sees all the keys of the start of
+// the iteration and none of the new keys, a weakly consistent iteration sees every key at most once.
+func TestIteratorsConsistency(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			fill(m, 100)
+
+			seen := map[string]bool{}
+			for key := range m.Keys() {
+				if seen[key] {
+					t.Fatalf("expected %s once", key)
+				}
+				seen[key] = true
+				m.Delete("key-" + strconv.Itoa(100-len(seen))) // from the last key
+				m.Set("new-"+key, 0)
+			}
+			if !snapshotIterators[tm.name] {
+				return
+			}
+			if len(seen) != 100 {
+				t.Fatalf("expected the 100 keys of the snapshot, got %d", len(seen))
+			}
+			for key := range seen {
+				if strings.HasPrefix(key, "new-") {
+					t.Fatalf("expected the snapshot not to see %s", key)
+				}
+			}
+		})
+	}
+}
+
+// TestIteratorsConcurrentWrites iterates while other goroutines write to the map (run with -race).
+func TestIteratorsConcurrentWrites(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			fill(m, 100)
+
+			var stop atomic.Bool
+			var wg sync.WaitGroup
+			for g := 0; g < testGoroutines/2; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; !stop.Load(); i++ {
+						key := "key-" + strconv.Itoa(100+(g*testIterations+i)%testIterations)
+						m.Set(key, i)
+						m.Delete(key)
+					}
+				}(g)
+			}
+
+			for i := 0; i < 20; i++ {
+				stable := 0
+				for key, val := range m.All() {
+					if n, err := strconv.Atoi(key[4:]); err == nil && n < 100 {
+						stable++
+						if val != n {
+							t.Errorf("expected %d for %s, got %d", n, key, val)
+						}
+					}
+				}
+				// the first 100 keys are never written, so every iteration sees them
+				if stable != 100 {
+					t.Errorf("expected the 100 stable keys, got %d", stable)
+				}
+			}
+			stop.Store(true)
+			wg.Wait()
+		})
+	}
+}
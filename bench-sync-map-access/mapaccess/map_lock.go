@@ -1,33 +1,138 @@
 package mapaccess
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"maps"
+	"sync"
+)
 
-type LockMap struct {
+type LockMap[K comparable, V any] struct {
 	mu    sync.Mutex
-	items map[string]any
+	items map[K]V
 }
 
-func NewLockMap() *LockMap {
-	return &LockMap{
-		items: make(map[string]any),
+// NewLockMap creates and returns a new LockMap with string keys and any values.
+func NewLockMap() *LockMap[string, any] {
+	return NewLockMapOf[string, any]()
+}
+
+// NewLockMapOf creates and returns a new LockMap with typed keys and values.
+func NewLockMapOf[K comparable, V any]() *LockMap[K, V] {
+	return &LockMap[K, V]{
+		items: make(map[K]V),
 	}
 }
 
-func (m *LockMap) Get(key string) (any, bool) {
+func (m *LockMap[K, V]) Get(key K) (V, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	val, ok := m.items[key]
 	return val, ok
 }
 
-func (m *LockMap) Set(key string, value any) {
+func (m *LockMap[K, V]) Set(key K, value V) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.items[key] = value
 }
 
-func (m *LockMap) Delete(key string) {
+func (m *LockMap[K, V]) Delete(key K) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.items, key)
 }
+
+func (m *LockMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if val, ok := m.items[key]; ok {
+		return val, true
+	}
+	m.items[key] = value
+	return value, false
+}
+
+func (m *LockMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if val, ok := m.items[key]; !ok || !equal(val, old) {
+		return false
+	}
+	m.items[key] = new
+	return true
+}
+
+func (m *LockMap[K, V]) CompareAndDelete(key K, old V) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if val, ok := m.items[key]; !ok || !equal(val, old) {
+		return false
+	}
+	delete(m.items, key)
+	return true
+}
+
+// Update calls fn with the lock held, so fn must not use the map.
+func (m *LockMap[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.items[key]
+	val = fn(val, ok)
+	m.items[key] = val
+	return val
+}
+
+// Range calls f for every key-value pair until f returns false, with the consistency of All.
+// f is never called with a lock held, so it may use the map.
+func (m *LockMap[K, V]) Range(f func(key K, value V) bool) {
+	rangeAll(m.All(), f)
+}
+
+func (m *LockMap[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// All returns an iterator over a copy of the map made with the lock held when the iteration starts,
+// so the iteration is a snapshot.
+func (m *LockMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.mu.Lock()
+		data := maps.Clone(m.items)
+		m.mu.Unlock()
+		mapAll(data)(yield)
+	}
+}
+
+// Keys returns an iterator over the keys of a snapshot of the map.
+func (m *LockMap[K, V]) Keys() iter.Seq[K] {
+	return keysOf(m.All())
+}
+
+// Values returns an iterator over the values of a snapshot of the map.
+func (m *LockMap[K, V]) Values() iter.Seq[V] {
+	return valuesOf(m.All())
+}
+
+// Snapshot writes a point-in-time snapshot of the map. The map is copied with the lock held and written without it,
+// so writers are only blocked during the copy.
+func (m *LockMap[K, V]) Snapshot(w io.Writer) error {
+	m.mu.Lock()
+	data := maps.Clone(m.items)
+	m.mu.Unlock()
+	return writeSnapshot(w, len(data), mapEntries(data))
+}
+
+// Restore replaces the content of the map with a snapshot. The snapshot is read before the lock is taken.
+func (m *LockMap[K, V]) Restore(r io.Reader) error {
+	data, err := readSnapshotMap[K, V](r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = data
+	return nil
+}
@@ -0,0 +1,160 @@
+package mapaccess
+
+import (
+	"math"
+	"math/bits"
+	"runtime/metrics"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The benchmarks of runBenchmark report the latency percentiles of the operations and the time spent waiting
+// for the locks, which ns/op (an average) hides:
+//   - p50-ns, p99-ns and p99.9-ns: percentiles of the latency of one operation in every latencySample operations
+//     (reading the clock adds a few tens of ns to every sample)
+//   - mutex-wait-ns/op: time blocked on a sync.Mutex or a sync.RWMutex per operation, summed over all the goroutines
+//     (from the runtime/metrics `/sync/mutex/wait/total:seconds`, which samples the wakeups and also counts the locks
+//     of the runtime, so it is an estimate)
+
+// latencySample is the share of the operations that are timed (one in latencySample), to keep the cost of the clock
+// out of ns/op.
+const latencySample = 16
+
+// histSubBits is the number of sub-buckets (as a power of two) of every power of two of a histogram,
+// so that a bucket is at most 1/16 of its values wide.
+const histSubBits = 4
+
+// histogram counts latencies in nanoseconds in log-linear buckets: the values below 16 have their own bucket and
+// every power of two above is split into 16 buckets.
+type histogram struct {
+	counts [64 << histSubBits]uint64
+	total  uint64
+}
+
+func histIndex(v uint64) int {
+	if v < 1<<histSubBits {
+		return int(v)
+	}
+	shift := bits.Len64(v) - histSubBits - 1 // v>>shift is in [16, 32)
+	return (shift+1)<<histSubBits + int(v>>shift) - 1<<histSubBits
+}
+
+// histValue returns the middle of a bucket
+func histValue(idx int) float64 {
+	if idx < 1<<histSubBits {
+		return float64(idx)
+	}
+	shift := idx>>histSubBits - 1
+	lower := uint64(idx&(1<<histSubBits-1)+1<<histSubBits) << shift
+	return float64(lower) + float64(uint64(1)<<shift-1)/2
+}
+
+func (h *histogram) record(d time.Duration) {
+	h.counts[histIndex(uint64(max(d, 0)))]++
+	h.total++
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.total += o.total
+}
+
+// percentile returns the latency in nanoseconds under which a share q of the values fall (0 without values)
+func (h *histogram) percentile(q float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.total)))
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			return histValue(i)
+		}
+	}
+	return histValue(len(h.counts) - 1)
+}
+
+// latencyRecorder merges the histograms of the goroutines of a benchmark
+type latencyRecorder struct {
+	mu   sync.Mutex
+	hist histogram
+}
+
+func (r *latencyRecorder) add(h *histogram) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hist.merge(h)
+}
+
+func (r *latencyRecorder) report(b *testing.B) {
+	b.ReportMetric(r.hist.percentile(0.5), "p50-ns")
+	b.ReportMetric(r.hist.percentile(0.99), "p99-ns")
+	b.ReportMetric(r.hist.percentile(0.999), "p99.9-ns")
+}
+
+const mutexWaitMetric = "/sync/mutex/wait/total:seconds"
+
+// mutexWait returns the time blocked on the locks since the start of the program
+func mutexWait() time.Duration {
+	sample := []metrics.Sample{{Name: mutexWaitMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return time.Duration(sample[0].Value.Float64() * float64(time.Second))
+}
+
+// reportMutexWait reports the time blocked on the locks per operation since start
+func reportMutexWait(b *testing.B, start time.Duration) {
+	b.ReportMetric(float64(mutexWait()-start)/float64(b.N), "mutex-wait-ns/op")
+}
+
+func TestHistogram(t *testing.T) {
+	for _, v := range []uint64{0, 1, 15, 16, 17, 31, 32, 33, 100, 1000, 123456789, math.MaxInt64} {
+		idx := histIndex(v)
+		if got := histValue(idx); math.Abs(got-float64(v)) > float64(v)/16+1 {
+			t.Fatalf("expected a bucket around %d, got %g", v, got)
+		}
+		if idx > 0 && histIndex(v-1) > idx {
+			t.Fatalf("expected increasing buckets, got %d after %d", idx, histIndex(v-1))
+		}
+	}
+
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i))
+	}
+	for _, c := range []struct{ q, want float64 }{{0.5, 500}, {0.99, 990}, {0.999, 999}} {
+		if got := h.percentile(c.q); math.Abs(got-c.want) > c.want/16 {
+			t.Fatalf("expected p%g around %g, got %g", c.q*100, c.want, got)
+		}
+	}
+	if got := (&histogram{}).percentile(0.99); got != 0 {
+		t.Fatalf("expected 0 without values, got %g", got)
+	}
+}
+
+func TestMutexWait(t *testing.T) {
+	// the runtime only times a sample of the wakeups of the goroutines, so the lock is contended many times
+	start := mutexWait()
+	var mu sync.Mutex
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		done := make(chan struct{})
+		go func() {
+			mu.Lock()
+			mu.Unlock()
+			close(done)
+		}()
+		time.Sleep(200 * time.Microsecond)
+		mu.Unlock()
+		<-done
+	}
+	if wait := mutexWait() - start; wait <= 0 {
+		t.Fatalf("expected the wait of the goroutines, got %s", wait)
+	}
+}
@@ -0,0 +1,250 @@
+package mapaccess
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The tests run against the generic (string/int) version of every map of BenchmarkBoxing.
+
+const (
+	testGoroutines = 8
+	testIterations = 1000
+)
+
+func TestMapOperations(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			if val, loaded := m.LoadOrStore("a", 1); loaded || val != 1 {
+				t.Fatalf("expected to store 1, got %d (loaded %t)", val, loaded)
+			}
+			if val, loaded := m.LoadOrStore("a", 2); !loaded || val != 1 {
+				t.Fatalf("expected to load 1, got %d (loaded %t)", val, loaded)
+			}
+			if m.CompareAndSwap("a", 2, 3) {
+				t.Fatalf("expected CompareAndSwap to fail with a wrong old value")
+			}
+			if m.CompareAndSwap("missing", 0, 3) {
+				t.Fatalf("expected CompareAndSwap to fail with a missing key")
+			}
+			if !m.CompareAndSwap("a", 1, 3) {
+				t.Fatalf("expected CompareAndSwap to swap 1 with 3")
+			}
+			if val := m.Update("a", func(old int, ok bool) int { return old + 1 }); val != 4 {
+				t.Fatalf("expected Update to return 4, got %d", val)
+			}
+			if val := m.Update("b", func(old int, ok bool) int {
+				if ok || old != 0 {
+					t.Errorf("expected a missing key, got %d (ok %t)", old, ok)
+				}
+				return 10
+			}); val != 10 {
+				t.Fatalf("expected Update to return 10, got %d", val)
+			}
+			m.Set("c", 20)
+			if m.Len() != 3 {
+				t.Fatalf("expected 3 keys, got %d", m.Len())
+			}
+
+			sum := 0
+			m.Range(func(key string, val int) bool {
+				sum += val
+				return true
+			})
+			if sum != 34 {
+				t.Fatalf("expected a sum of 34, got %d", sum)
+			}
+			calls := 0
+			m.Range(func(key string, val int) bool {
+				calls++
+				return false
+			})
+			if calls != 1 {
+				t.Fatalf("expected Range to stop after 1 call, got %d", calls)
+			}
+
+			if m.CompareAndDelete("a", 3) {
+				t.Fatalf("expected CompareAndDelete to fail with a wrong old value")
+			}
+			if !m.CompareAndDelete("a", 4) {
+				t.Fatalf("expected CompareAndDelete to delete a")
+			}
+			m.Delete("b")
+			m.Delete("missing")
+			if _, ok := m.Get("a"); ok || m.Len() != 1 {
+				t.Fatalf("expected 1 key, got %d", m.Len())
+			}
+		})
+	}
+}
+
+// TestMapRangeUsesMap reads and writes the map from the Range callback, which must not deadlock on any map.
+func TestMapRangeUsesMap(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			fill(m, 100)
+
+			calls := 0
+			m.Range(func(key string, val int) bool {
+				calls++
+				if got, ok := m.Get(key); !ok || got != val {
+					t.Errorf("expected %d for %s, got %d (%t)", val, key, got, ok)
+				}
+				m.Update(key, func(old int, ok bool) int { return old + 1 })
+				return true
+			})
+			sum := 0
+			for val := range m.Values() {
+				sum += val
+			}
+			if calls != 100 || sum != 4950+100 {
+				t.Fatalf("expected 100 calls and a sum of 5050, got %d calls and %d", calls, sum)
+			}
+		})
+	}
+}
+
+// TestMapUpdateIncomparable updates values that are not comparable ([]int) or not equal to themselves (NaN):
+// Update must not compare the values.
+func TestMapUpdateIncomparable(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.boxed(t)
+			for i := 0; i < 3; i++ {
+				m.Update("slice", func(old any, ok bool) any {
+					s, _ := old.([]int)
+					return append(s, i)
+				})
+				m.Update("nan", func(old any, ok bool) any { return math.NaN() })
+			}
+			if val, ok := m.Get("slice"); !ok || len(val.([]int)) != 3 {
+				t.Fatalf("expected a slice of 3 values, got %v", val)
+			}
+			if val, ok := m.Get("nan"); !ok || !math.IsNaN(val.(float64)) {
+				t.Fatalf("expected NaN, got %v", val)
+			}
+			if m.Len() != 2 {
+				t.Fatalf("expected 2 keys, got %d", m.Len())
+			}
+		})
+	}
+}
+
+// TestMapUpdateConcurrent increments counters from several goroutines: no increment may be lost.
+func TestMapUpdateConcurrent(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			runConcurrently(func(g int) {
+				for i := 0; i < testIterations; i++ {
+					m.Update("key-"+strconv.Itoa(i%10), func(old int, ok bool) int { return old + 1 })
+				}
+			})
+			total := 0
+			m.Range(func(key string, val int) bool {
+				total += val
+				return true
+			})
+			if total != testGoroutines*testIterations || m.Len() != 10 {
+				t.Fatalf("expected %d increments on 10 keys, got %d on %d keys", testGoroutines*testIterations, total, m.Len())
+			}
+		})
+	}
+}
+
+// TestMapCompareAndSwapConcurrent increments a counter with CompareAndSwap loops from several goroutines.
+func TestMapCompareAndSwapConcurrent(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			m.Set("counter", 0)
+			runConcurrently(func(g int) {
+				for i := 0; i < testIterations; i++ {
+					for {
+						old, _ := m.Get("counter")
+						if m.CompareAndSwap("counter", old, old+1) {
+							break
+						}
+					}
+				}
+			})
+			if val, _ := m.Get("counter"); val != testGoroutines*testIterations {
+				t.Fatalf("expected %d, got %d", testGoroutines*testIterations, val)
+			}
+		})
+	}
+}
+
+// TestMapLoadOrStoreConcurrent stores every key from several goroutines: exactly one store must win per key
+// and every goroutine must see its value.
+func TestMapLoadOrStoreConcurrent(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			var stored atomic.Int64
+			actual := make([][]int, testGoroutines)
+			runConcurrently(func(g int) {
+				actual[g] = make([]int, testIterations)
+				for i := 0; i < testIterations; i++ {
+					val, loaded := m.LoadOrStore("key-"+strconv.Itoa(i), g)
+					if !loaded {
+						stored.Add(1)
+					}
+					actual[g][i] = val
+				}
+			})
+			if stored.Load() != testIterations || m.Len() != testIterations {
+				t.Fatalf("expected %d stores, got %d (%d keys)", testIterations, stored.Load(), m.Len())
+			}
+			for i := 0; i < testIterations; i++ {
+				winner, _ := m.Get("key-" + strconv.Itoa(i))
+				for g := range actual {
+					if actual[g][i] != winner {
+						t.Fatalf("expected goroutine %d to load %d for key-%d, got %d", g, winner, i, actual[g][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestMapCompareAndDeleteConcurrent deletes every key from several goroutines: exactly one delete must win per key.
+func TestMapCompareAndDeleteConcurrent(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			for i := 0; i < testIterations; i++ {
+				m.Set("key-"+strconv.Itoa(i), i)
+			}
+			var deleted atomic.Int64
+			runConcurrently(func(g int) {
+				for i := 0; i < testIterations; i++ {
+					if m.CompareAndDelete("key-"+strconv.Itoa(i), i) {
+						deleted.Add(1)
+					}
+				}
+			})
+			if deleted.Load() != testIterations || m.Len() != 0 {
+				t.Fatalf("expected %d deletes, got %d (%d keys left)", testIterations, deleted.Load(), m.Len())
+			}
+		})
+	}
+}
+
+// runConcurrently runs f in testGoroutines goroutines and waits for them.
+func runConcurrently(f func(g int)) {
+	var wg sync.WaitGroup
+	for g := 0; g < testGoroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(g)
+		}()
+	}
+	wg.Wait()
+}
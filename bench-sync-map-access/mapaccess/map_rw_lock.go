@@ -1,29 +1,39 @@
 package mapaccess
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"maps"
+	"sync"
+)
 
 // RWLockMap is a struct with a map data structure and a RWMutex.
-type RWLockMap struct {
-	data map[string]any
+type RWLockMap[K comparable, V any] struct {
+	data map[K]V
 	sync.RWMutex
 }
 
-// NewRWLockMap creates and returns a new RWLockMap.
-func NewRWLockMap() *RWLockMap {
-	return &RWLockMap{
-		data: make(map[string]any),
+// NewRWLockMap creates and returns a new RWLockMap with string keys and any values.
+func NewRWLockMap() *RWLockMap[string, any] {
+	return NewRWLockMapOf[string, any]()
+}
+
+// NewRWLockMapOf creates and returns a new RWLockMap with typed keys and values.
+func NewRWLockMapOf[K comparable, V any]() *RWLockMap[K, V] {
+	return &RWLockMap[K, V]{
+		data: make(map[K]V),
 	}
 }
 
 // Set sets a key-value pair in the map.
-func (m *RWLockMap) Set(key string, value any) {
+func (m *RWLockMap[K, V]) Set(key K, value V) {
 	m.Lock()
 	defer m.Unlock()
 	m.data[key] = value
 }
 
 // Get retrieves a value from the map by key.
-func (m *RWLockMap) Get(key string) (any, bool) {
+func (m *RWLockMap[K, V]) Get(key K) (V, bool) {
 	m.RLock() // Use RLock for read operations
 	defer m.RUnlock()
 	val, ok := m.data[key]
@@ -31,8 +41,106 @@ func (m *RWLockMap) Get(key string) (any, bool) {
 }
 
 // Delete removes a key-value pair from the map.
-func (m *RWLockMap) Delete(key string) {
+func (m *RWLockMap[K, V]) Delete(key K) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.data, key)
+}
+
+// LoadOrStore returns the existing value of a key or stores and returns the given value.
+func (m *RWLockMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	m.Lock()
+	defer m.Unlock()
+	if val, ok := m.data[key]; ok {
+		return val, true
+	}
+	m.data[key] = value
+	return value, false
+}
+
+// CompareAndSwap swaps the value of a key if it is equal to old.
+func (m *RWLockMap[K, V]) CompareAndSwap(key K, old, new V) bool {
 	m.Lock()
 	defer m.Unlock()
+	if val, ok := m.data[key]; !ok || !equal(val, old) {
+		return false
+	}
+	m.data[key] = new
+	return true
+}
+
+// CompareAndDelete deletes a key if its value is equal to old.
+func (m *RWLockMap[K, V]) CompareAndDelete(key K, old V) bool {
+	m.Lock()
+	defer m.Unlock()
+	if val, ok := m.data[key]; !ok || !equal(val, old) {
+		return false
+	}
 	delete(m.data, key)
+	return true
+}
+
+// Update replaces the value of a key with the result of fn. fn is called with the lock held, so it must not use the map.
+func (m *RWLockMap[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	m.Lock()
+	defer m.Unlock()
+	val, ok := m.data[key]
+	val = fn(val, ok)
+	m.data[key] = val
+	return val
+}
+
+// Range calls f for every key-value pair until f returns false, with the consistency of All.
+// f is never called with a lock held, so it may use the map.
+func (m *RWLockMap[K, V]) Range(f func(key K, value V) bool) {
+	rangeAll(m.All(), f)
+}
+
+// Len returns the number of keys in the map.
+func (m *RWLockMap[K, V]) Len() int {
+	m.RLock()
+	defer m.RUnlock()
+	return len(m.data)
+}
+
+// All returns an iterator over a copy of the map made with the read lock held when the iteration starts,
+// so the iteration is a snapshot.
+func (m *RWLockMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.RLock()
+		data := maps.Clone(m.data)
+		m.RUnlock()
+		mapAll(data)(yield)
+	}
+}
+
+// Keys returns an iterator over the keys of a snapshot of the map.
+func (m *RWLockMap[K, V]) Keys() iter.Seq[K] {
+	return keysOf(m.All())
+}
+
+// Values returns an iterator over the values of a snapshot of the map.
+func (m *RWLockMap[K, V]) Values() iter.Seq[V] {
+	return valuesOf(m.All())
+}
+
+// Snapshot writes a point-in-time snapshot of the map. The map is copied with the read lock held and written without
+// it, so writers are only blocked during the copy.
+func (m *RWLockMap[K, V]) Snapshot(w io.Writer) error {
+	m.RLock()
+	data := maps.Clone(m.data)
+	m.RUnlock()
+	return writeSnapshot(w, len(data), mapEntries(data))
+}
+
+// Restore replaces the content of the map with a snapshot. The snapshot is read before the lock is taken.
+func (m *RWLockMap[K, V]) Restore(r io.Reader) error {
+	data, err := readSnapshotMap[K, V](r)
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.data = data
+	return nil
 }
@@ -0,0 +1,253 @@
+package mapaccess
+
+import (
+	"hash/maphash"
+	"io"
+	"iter"
+	"maps"
+	"runtime"
+	"sync"
+)
+
+// ShardedMap is a generic map split into shards, each with its own map and RWMutex.
+// Keys are spread over the shards with hash/maphash (or the hash of WithHash), so writers to different shards don't
+// contend.
+type ShardedMap[K comparable, V any] struct {
+	seed   maphash.Seed
+	hash   func(K) uint64 // nil for maphash
+	mask   uint64
+	shards []mapShard[K, V]
+}
+
+// ShardedOption is an option of NewShardedMap and NewShardedMapWithShards.
+type ShardedOption[K comparable] func(*shardedOptions[K])
+
+type shardedOptions[K comparable] struct {
+	hash func(K) uint64
+}
+
+// WithHash spreads the keys over the shards with a custom hash instead of hash/maphash (e.g. a cheaper hash for
+// integer keys). The low bits of the hash select the shard, so they must be well distributed.
+func WithHash[K comparable](hash func(K) uint64) ShardedOption[K] {
+	return func(o *shardedOptions[K]) {
+		o.hash = hash
+	}
+}
+
+// mapShard is a single shard of a ShardedMap.
+type mapShard[K comparable, V any] struct {
+	sync.RWMutex
+	data map[K]V
+	_    [32]byte // pad the shard (mutex and map pointer) to a cache line to avoid false sharing
+}
+
+// NewShardedMap creates and returns a new ShardedMap with 4 shards per CPU (GOMAXPROCS).
+func NewShardedMap[K comparable, V any](opts ...ShardedOption[K]) *ShardedMap[K, V] {
+	return NewShardedMapWithShards[K, V](4*runtime.GOMAXPROCS(0), opts...)
+}
+
+// NewShardedMapWithShards creates and returns a new ShardedMap.
+// The number of shards is rounded up to a power of two.
+func NewShardedMapWithShards[K comparable, V any](shards int, opts ...ShardedOption[K]) *ShardedMap[K, V] {
+	var o shardedOptions[K]
+	for _, opt := range opts {
+		opt(&o)
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	m := &ShardedMap[K, V]{
+		seed:   maphash.MakeSeed(),
+		hash:   o.hash,
+		mask:   uint64(n - 1),
+		shards: make([]mapShard[K, V], n),
+	}
+	for i := range m.shards {
+		m.shards[i].data = make(map[K]V)
+	}
+	return m
+}
+
+// shard returns the shard of a key.
+func (m *ShardedMap[K, V]) shard(key K) *mapShard[K, V] {
+	return &m.shards[m.index(key)]
+}
+
+// index returns the index of the shard of a key.
+func (m *ShardedMap[K, V]) index(key K) uint64 {
+	if m.hash != nil {
+		return m.hash(key) & m.mask
+	}
+	return maphash.Comparable(m.seed, key) & m.mask
+}
+
+// Shards returns the number of shards.
+func (m *ShardedMap[K, V]) Shards() int {
+	return len(m.shards)
+}
+
+// Set sets a key-value pair in the map.
+func (m *ShardedMap[K, V]) Set(key K, value V) {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	s.data[key] = value
+}
+
+// Get retrieves a value from the map by key.
+func (m *ShardedMap[K, V]) Get(key K) (V, bool) {
+	s := m.shard(key)
+	s.RLock()
+	defer s.RUnlock()
+	val, ok := s.data[key]
+	return val, ok
+}
+
+// Delete removes a key-value pair from the map.
+func (m *ShardedMap[K, V]) Delete(key K) {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	delete(s.data, key)
+}
+
+// LoadOrStore returns the existing value of a key or stores and returns the given value.
+func (m *ShardedMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if val, ok := s.data[key]; ok {
+		return val, true
+	}
+	s.data[key] = value
+	return value, false
+}
+
+// CompareAndSwap swaps the value of a key if it is equal to old.
+func (m *ShardedMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if val, ok := s.data[key]; !ok || !equal(val, old) {
+		return false
+	}
+	s.data[key] = new
+	return true
+}
+
+// CompareAndDelete deletes a key if its value is equal to old.
+func (m *ShardedMap[K, V]) CompareAndDelete(key K, old V) bool {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if val, ok := s.data[key]; !ok || !equal(val, old) {
+		return false
+	}
+	delete(s.data, key)
+	return true
+}
+
+// Update replaces the value of a key with the result of fn.
+// fn is called with the lock of the shard held, so it must not use the map.
+func (m *ShardedMap[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	s := m.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	val, ok := s.data[key]
+	val = fn(val, ok)
+	s.data[key] = val
+	return val
+}
+
+// Range calls f for every key-value pair until f returns false, with the consistency of All.
+// f is never called with a lock held, so it may use the map.
+func (m *ShardedMap[K, V]) Range(f func(key K, value V) bool) {
+	rangeAll(m.All(), f)
+}
+
+// Len returns the number of keys in the map (the shards are counted one after the other).
+func (m *ShardedMap[K, V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.RLock()
+		n += len(s.data)
+		s.RUnlock()
+	}
+	return n
+}
+
+// All returns an iterator over the shards, one after the other. Every shard is copied with its read lock held when
+// the iteration reaches it, so the iteration is weakly consistent: a snapshot of every shard, but not of the map.
+func (m *ShardedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := range m.shards {
+			s := &m.shards[i]
+			s.RLock()
+			data := maps.Clone(s.data)
+			s.RUnlock()
+			for key, val := range data {
+				if !yield(key, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the map, weakly consistent like All.
+func (m *ShardedMap[K, V]) Keys() iter.Seq[K] {
+	return keysOf(m.All())
+}
+
+// Values returns an iterator over the values of the map, weakly consistent like All.
+func (m *ShardedMap[K, V]) Values() iter.Seq[V] {
+	return valuesOf(m.All())
+}
+
+// Snapshot writes a point-in-time snapshot of the map. The shards are copied with all their read locks held
+// and written without them, so writers are only blocked during the copy.
+func (m *ShardedMap[K, V]) Snapshot(w io.Writer) error {
+	for i := range m.shards {
+		m.shards[i].RLock()
+	}
+	n := 0
+	for i := range m.shards {
+		n += len(m.shards[i].data)
+	}
+	data := make(map[K]V, n)
+	for i := range m.shards {
+		for key, val := range m.shards[i].data {
+			data[key] = val
+		}
+	}
+	for i := range m.shards {
+		m.shards[i].RUnlock()
+	}
+	return writeSnapshot(w, len(data), mapEntries(data))
+}
+
+// Restore replaces the content of the map with a snapshot. The snapshot is read and split between the shards before
+// the locks are taken, then all the shards are replaced at once.
+func (m *ShardedMap[K, V]) Restore(r io.Reader) error {
+	data, err := readSnapshotMap[K, V](r)
+	if err != nil {
+		return err
+	}
+	shards := make([]map[K]V, len(m.shards))
+	for i := range shards {
+		shards[i] = make(map[K]V, len(data)/len(shards))
+	}
+	for key, val := range data {
+		shards[m.index(key)][key] = val
+	}
+	for i := range m.shards {
+		m.shards[i].Lock()
+	}
+	for i := range m.shards {
+		m.shards[i].data = shards[i]
+		m.shards[i].Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package mapaccess
+
+import (
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
+
+func TestShardedMap(t *testing.T) {
+	m := NewShardedMapWithShards[string, int](5)
+	if m.Shards() != 8 {
+		t.Fatalf("expected 8 shards, got %d", m.Shards())
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get("key-" + strconv.Itoa(i)); !ok || val != i {
+			t.Fatalf("expected %d for key-%d, got %d (%t)", i, i, val, ok)
+		}
+	}
+	m.Delete("key-1")
+	if _, ok := m.Get("key-1"); ok {
+		t.Fatalf("expected key-1 to be deleted")
+	}
+}
+
+func TestShardedMapWithHash(t *testing.T) {
+	calls := 0
+	fnvHash := func(key string) uint64 {
+		calls++
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		return h.Sum64()
+	}
+	m := NewShardedMapWithShards[string, int](4, WithHash(fnvHash))
+	for i := 0; i < 1000; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+	if calls != 1000 {
+		t.Fatalf("expected the custom hash to be called 1000 times, got %d", calls)
+	}
+	// every key is in the shard selected by the custom hash
+	for i := range m.shards {
+		for key := range m.shards[i].data {
+			if idx := fnvHash(key) & m.mask; idx != uint64(i) {
+				t.Fatalf("expected %s in shard %d, found in shard %d", key, idx, i)
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if val, ok := m.Get("key-" + strconv.Itoa(i)); !ok || val != i {
+			t.Fatalf("expected %d for key-%d, got %d (%t)", i, i, val, ok)
+		}
+	}
+
+	// a constant hash puts every key in the same shard
+	m = NewShardedMapWithShards[string, int](4, WithHash(func(string) uint64 { return 2 }))
+	for i := 0; i < 100; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+	if len(m.shards[2].data) != 100 || m.Len() != 100 {
+		t.Fatalf("expected 100 keys in shard 2, got %d (len %d)", len(m.shards[2].data), m.Len())
+	}
+}
@@ -0,0 +1,145 @@
+package mapaccess
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"time"
+)
+
+// Snapshotter is implemented by all the maps to save their content and warm-start a map from it.
+type Snapshotter interface {
+	// Snapshot writes the key-value pairs of the map to w.
+	Snapshot(w io.Writer) error
+	// Restore replaces the content of the map with a snapshot. The map is unchanged if the snapshot can't be read.
+	Restore(r io.Reader) error
+}
+
+var (
+	_ Snapshotter = (*LockMap[string, any])(nil)
+	_ Snapshotter = (*RWLockMap[string, any])(nil)
+	_ Snapshotter = (*SyncMap[string, any])(nil)
+	_ Snapshotter = (*ShardedMap[string, any])(nil)
+	_ Snapshotter = (*TTLMap[string, any])(nil)
+	_ Snapshotter = (*LRUMap[string, any])(nil)
+	_ Snapshotter = (*COWMap[string, any])(nil)
+)
+
+// A snapshot is the magic string and the version of the format, followed by a gob stream of a snapshotHeader and
+// of the entries. All the maps share the format, so a snapshot can be restored into another implementation with the
+// same key and value types. The concrete types stored in `any` values must be registered with gob.Register
+// (except the basic types).
+const (
+	snapshotMagic   = "MAPSNAP"
+	snapshotVersion = 1
+	// snapshotPrealloc is the maximum number of entries allocated before they are read
+	snapshotPrealloc = 1 << 16
+)
+
+var (
+	// ErrSnapshotFormat is returned by Restore for data that is not a snapshot.
+	ErrSnapshotFormat = errors.New("mapaccess: not a map snapshot")
+	// ErrSnapshotVersion is returned by Restore for a snapshot of an unknown version of the format.
+	ErrSnapshotVersion = errors.New("mapaccess: unsupported snapshot version")
+	// ErrSnapshotType is returned by Restore for a snapshot of a map with other key or value types.
+	ErrSnapshotType = errors.New("mapaccess: snapshot of another key or value type")
+)
+
+type snapshotHeader struct {
+	KeyType   string
+	ValueType string
+	Len       int // number of entries
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	Key     K
+	Value   V
+	Expires int64 // unix nanoseconds, 0 if the entry never expires (TTLMap only)
+}
+
+// writeSnapshot writes a snapshot of n entries.
+func writeSnapshot[K comparable, V any](w io.Writer, n int, entries iter.Seq[snapshotEntry[K, V]]) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+	enc := gob.NewEncoder(bw)
+	if err := enc.Encode(snapshotHeader{KeyType: typeName[K](), ValueType: typeName[V](), Len: n}); err != nil {
+		return err
+	}
+	for e := range entries {
+		if err := enc.Encode(&e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readSnapshot reads a snapshot and returns its entries that have not expired.
+func readSnapshot[K comparable, V any](r io.Reader) ([]snapshotEntry[K, V], error) {
+	br := bufio.NewReader(r)
+	prefix := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, prefix); err != nil || string(prefix[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotFormat
+	}
+	if prefix[len(snapshotMagic)] != snapshotVersion {
+		return nil, fmt.Errorf("%w %d", ErrSnapshotVersion, prefix[len(snapshotMagic)])
+	}
+
+	dec := gob.NewDecoder(br)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("mapaccess: snapshot header: %w", err)
+	}
+	if header.KeyType != typeName[K]() || header.ValueType != typeName[V]() {
+		return nil, fmt.Errorf("%w: map[%s]%s", ErrSnapshotType, header.KeyType, header.ValueType)
+	}
+	if header.Len < 0 {
+		return nil, fmt.Errorf("%w: negative length %d", ErrSnapshotFormat, header.Len)
+	}
+	// the length is read from the input, so a corrupted length can't allocate more than snapshotPrealloc entries
+	entries := make([]snapshotEntry[K, V], 0, min(header.Len, snapshotPrealloc))
+	now := time.Now().UnixNano()
+	for i := 0; i < header.Len; i++ {
+		var e snapshotEntry[K, V]
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("mapaccess: snapshot entry %d: %w", i, err)
+		}
+		if e.Expires != 0 && now >= e.Expires {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// readSnapshotMap reads a snapshot into a new map.
+func readSnapshotMap[K comparable, V any](r io.Reader) (map[K]V, error) {
+	entries, err := readSnapshot[K, V](r)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[K]V, len(entries))
+	for _, e := range entries {
+		data[e.Key] = e.Value
+	}
+	return data, nil
+}
+
+// mapEntries returns the entries of a map that is not modified during the iteration.
+func mapEntries[K comparable, V any](data map[K]V) iter.Seq[snapshotEntry[K, V]] {
+	return func(yield func(snapshotEntry[K, V]) bool) {
+		for key, val := range data {
+			if !yield(snapshotEntry[K, V]{Key: key, Value: val}) {
+				return
+			}
+		}
+	}
+}
+
+func typeName[T any]() string {
+	return reflect.TypeFor[T]().String()
+}
@@ -0,0 +1,255 @@
+package mapaccess
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// snapshotKeys is the size of the maps of the round trips (the LRU maps keep benchCapacity keys).
+const snapshotKeys = 100000
+
+// contents returns the key-value pairs of a map.
+func contents[V any](m Map[string, V]) map[string]V {
+	data := map[string]V{}
+	m.Range(func(key string, val V) bool {
+		data[key] = val
+		return true
+	})
+	return data
+}
+
+// fill sets n keys (with a single batch for a COWMap, which copies the map on every Set).
+func fill(m Map[string, int], n int) {
+	set := func(data map[string]int) {
+		for i := 0; i < n; i++ {
+			data["key-"+strconv.Itoa(i)] = i
+		}
+	}
+	if cow, ok := m.(*COWMap[string, int]); ok {
+		cow.Batch(set)
+		return
+	}
+	for i := 0; i < n; i++ {
+		m.Set("key-"+strconv.Itoa(i), i)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, tm := range boxingMaps {
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			fill(m, snapshotKeys)
+			want := contents(m)
+
+			var buf bytes.Buffer
+			if err := m.(Snapshotter).Snapshot(&buf); err != nil {
+				t.Fatal(err)
+			}
+			snapshot := buf.Bytes()
+
+			restored := tm.typed(t)
+			restored.Set("stale", -1) // replaced by the snapshot
+			if err := restored.(Snapshotter).Restore(bytes.NewReader(snapshot)); err != nil {
+				t.Fatal(err)
+			}
+			got := contents(restored)
+			if len(got) != len(want) || restored.Len() != len(want) {
+				t.Fatalf("expected %d keys, got %d (Len %d)", len(want), len(got), restored.Len())
+			}
+			for key, val := range want {
+				if got[key] != val {
+					t.Fatalf("expected %d for %s, got %d", val, key, got[key])
+				}
+			}
+
+			// every map reads the snapshots of the other maps
+			sharded := NewShardedMapWithShards[string, int](8)
+			if err := sharded.Restore(bytes.NewReader(snapshot)); err != nil {
+				t.Fatal(err)
+			}
+			if sharded.Len() != len(want) {
+				t.Fatalf("expected %d keys in a ShardedMap, got %d", len(want), sharded.Len())
+			}
+		})
+	}
+}
+
+// TestSnapshotWhileWriting checks that the snapshots of the lock-based maps are point-in-time: a single writer adds
+// the keys in order, so a snapshot holds the first n keys without any gap (the LRU maps hold all the keys).
+func TestSnapshotWhileWriting(t *testing.T) {
+	for _, tm := range boxingMaps {
+		if tm.name == "SyncMap" {
+			continue // weakly consistent
+		}
+		t.Run(tm.name, func(t *testing.T) {
+			m := tm.typed(t)
+			var done atomic.Bool
+			go func() {
+				defer done.Store(true)
+				for i := 0; i < 2000; i++ {
+					m.Set("key-"+strconv.Itoa(i), i)
+				}
+			}()
+
+			for snapshots := 0; !done.Load() || snapshots == 0; snapshots++ {
+				var buf bytes.Buffer
+				if err := m.(Snapshotter).Snapshot(&buf); err != nil {
+					t.Fatal(err)
+				}
+				restored := NewLockMapOf[string, int]()
+				if err := restored.Restore(&buf); err != nil {
+					t.Fatal(err)
+				}
+				n := restored.Len()
+				for i := 0; i < n; i++ {
+					if _, ok := restored.Get("key-" + strconv.Itoa(i)); !ok {
+						t.Fatalf("expected the first %d keys, key-%d is missing", n, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotExpiry(t *testing.T) {
+	m := NewTTLMap(time.Hour, CacheOptions[string, int]{})
+	defer m.Close()
+	m.Set("a", 1)
+	m.SetWithTTL("b", 2, 20*time.Millisecond)
+	var buf bytes.Buffer
+	if err := m.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	restored := NewTTLMap(time.Hour, CacheOptions[string, int]{})
+	defer restored.Close()
+	if err := restored.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() != 2 {
+		t.Fatalf("expected 2 keys, got %d", restored.Len())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := restored.Get("b"); ok {
+		t.Fatalf("expected b to keep its expiry time")
+	}
+
+	// the expired entries are not restored
+	if err := restored.Restore(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.Get("a"); !ok || restored.Len() != 1 {
+		t.Fatalf("expected only a, got %d keys", restored.Len())
+	}
+}
+
+func TestSnapshotLRUOrder(t *testing.T) {
+	m := NewLRUMap(3, CacheOptions[string, int]{})
+	m.Set("a", 1)
+	m.Set("b", 2)
+	m.Set("c", 3)
+	m.Get("a") // b is the least recently used key
+	var buf bytes.Buffer
+	if err := m.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewLRUMap(3, CacheOptions[string, int]{})
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored.Set("d", 4)
+	if _, ok := restored.Get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if _, ok := restored.Get("a"); !ok {
+		t.Fatalf("expected a to be kept")
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	m := NewLockMapOf[string, int]()
+	m.Set("a", 1)
+	var buf bytes.Buffer
+	if err := m.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	restored := NewRWLockMapOf[string, int]()
+	restored.Set("kept", 1)
+	if err := restored.Restore(bytes.NewReader([]byte("not a snapshot"))); !errors.Is(err, ErrSnapshotFormat) {
+		t.Fatalf("expected ErrSnapshotFormat, got %v", err)
+	}
+	newer := bytes.Clone(snapshot)
+	newer[len(snapshotMagic)] = snapshotVersion + 1
+	if err := restored.Restore(bytes.NewReader(newer)); !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("expected ErrSnapshotVersion, got %v", err)
+	}
+	if err := restored.Restore(bytes.NewReader(snapshot[:len(snapshot)-2])); err == nil {
+		t.Fatalf("expected an error for a truncated snapshot")
+	}
+	if err := NewCOWMapOf[string, string]().Restore(bytes.NewReader(snapshot)); !errors.Is(err, ErrSnapshotType) {
+		t.Fatalf("expected ErrSnapshotType, got %v", err)
+	}
+	// the length of the header is not trusted
+	entries := slices.Values([]snapshotEntry[string, int]{{Key: "a", Value: 1}})
+	for _, n := range []int{-1, 1 << 50} {
+		var corrupted bytes.Buffer
+		if err := writeSnapshot(&corrupted, n, entries); err != nil {
+			t.Fatal(err)
+		}
+		if err := restored.Restore(&corrupted); err == nil || (n < 0 && !errors.Is(err, ErrSnapshotFormat)) {
+			t.Fatalf("expected an error for a length of %d, got %v", n, err)
+		}
+	}
+	if _, ok := restored.Get("kept"); !ok || restored.Len() != 1 {
+		t.Fatalf("expected the map to be unchanged after the errors")
+	}
+}
+
+// BenchmarkSnapshot measures a snapshot of a map with a writer running (the time the writers are blocked is
+// reported in mutex-wait-ns/op).
+func BenchmarkSnapshot(b *testing.B) {
+	k := newBenchKeys(10000)
+	for _, bm := range benchMaps {
+		b.Run(bm.name, func(b *testing.B) {
+			m := bm.new()
+			if closer, ok := m.(interface{ Close() }); ok {
+				defer closer.Close()
+			}
+			for i := range k.keys {
+				m.Set(k.keys[i], k.values[i])
+			}
+			var stop atomic.Bool
+			writerDone := make(chan struct{})
+			go func() {
+				defer close(writerDone)
+				for i := 0; !stop.Load(); i = (i + 1) % len(k.keys) {
+					m.Set(k.keys[i], k.values[i])
+				}
+			}()
+			var buf bytes.Buffer
+			waited := mutexWait()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := m.(Snapshotter).Snapshot(&buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			stop.Store(true)
+			<-writerDone
+			reportMutexWait(b, waited)
+			b.ReportMetric(float64(buf.Len()), "bytes")
+		})
+	}
+}
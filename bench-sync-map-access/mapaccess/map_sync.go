@@ -1,28 +1,179 @@
 package mapaccess
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
 
 // SyncMap is a struct with a sync.Map data structure.
-type SyncMap struct {
+// The sync.Map stores keys and values as `any`, so the typed keys and values are still boxed internally.
+// Every value is stored behind a pointer to an entry, so the compare-and-swap of Update compares the entries
+// by identity and works with values that are not comparable or not equal to themselves (NaN).
+type SyncMap[K comparable, V any] struct {
 	data sync.Map
+	len  atomic.Int64 // sync.Map has no length, so it is counted on every insert and delete
 }
 
-// NewSyncMap creates and returns a new SyncMap.
-func NewSyncMap() *SyncMap {
-	return &SyncMap{}
+// syncEntry is a value of a SyncMap.
+type syncEntry[V any] struct {
+	v V
+}
+
+// NewSyncMap creates and returns a new SyncMap with string keys and any values.
+func NewSyncMap() *SyncMap[string, any] {
+	return NewSyncMapOf[string, any]()
+}
+
+// NewSyncMapOf creates and returns a new SyncMap with typed keys and values.
+func NewSyncMapOf[K comparable, V any]() *SyncMap[K, V] {
+	return &SyncMap[K, V]{}
 }
 
 // Set sets a key-value pair in the map.
-func (m *SyncMap) Set(key string, value any) {
-	m.data.Store(key, value)
+func (m *SyncMap[K, V]) Set(key K, value V) {
+	if _, loaded := m.data.Swap(key, &syncEntry[V]{v: value}); !loaded {
+		m.len.Add(1)
+	}
 }
 
 // Get retrieves a value from the map by key.
-func (m *SyncMap) Get(key string) (any, bool) {
-	return m.data.Load(key)
+func (m *SyncMap[K, V]) Get(key K) (V, bool) {
+	val, ok := m.data.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return val.(*syncEntry[V]).v, true
 }
 
 // Delete removes a key-value pair from the map.
-func (m *SyncMap) Delete(key string) {
-	m.data.Delete(key)
+func (m *SyncMap[K, V]) Delete(key K) {
+	if _, loaded := m.data.LoadAndDelete(key); loaded {
+		m.len.Add(-1)
+	}
+}
+
+// LoadOrStore returns the existing value of a key or stores and returns the given value.
+func (m *SyncMap[K, V]) LoadOrStore(key K, value V) (V, bool) {
+	if val, ok := m.data.Load(key); ok {
+		return val.(*syncEntry[V]).v, true
+	}
+	val, loaded := m.data.LoadOrStore(key, &syncEntry[V]{v: value})
+	if !loaded {
+		m.len.Add(1)
+	}
+	return val.(*syncEntry[V]).v, loaded
+}
+
+// CompareAndSwap swaps the value of a key if it is equal to old.
+// The value is compared, then its entry is swapped, so the swap fails if the entry was replaced concurrently.
+func (m *SyncMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	for {
+		val, ok := m.data.Load(key)
+		if !ok || !equal(val.(*syncEntry[V]).v, old) {
+			return false
+		}
+		if m.data.CompareAndSwap(key, val, &syncEntry[V]{v: new}) {
+			return true
+		}
+	}
+}
+
+// CompareAndDelete deletes a key if its value is equal to old.
+func (m *SyncMap[K, V]) CompareAndDelete(key K, old V) bool {
+	for {
+		val, ok := m.data.Load(key)
+		if !ok || !equal(val.(*syncEntry[V]).v, old) {
+			return false
+		}
+		if m.data.CompareAndDelete(key, val) {
+			m.len.Add(-1)
+			return true
+		}
+	}
+}
+
+// Update replaces the value of a key with the result of fn. The sync.Map has no lock, so the entry is swapped with
+// LoadOrStore and CompareAndSwap and fn is called again if the entry was replaced concurrently.
+// The entries are compared by identity, so V does not need to be comparable.
+func (m *SyncMap[K, V]) Update(key K, fn func(old V, ok bool) V) V {
+	for {
+		val, ok := m.data.Load(key)
+		if !ok {
+			var zero V
+			new := fn(zero, false)
+			if _, loaded := m.data.LoadOrStore(key, &syncEntry[V]{v: new}); !loaded {
+				m.len.Add(1)
+				return new
+			}
+			continue
+		}
+		new := fn(val.(*syncEntry[V]).v, true)
+		if m.data.CompareAndSwap(key, val, &syncEntry[V]{v: new}) {
+			return new
+		}
+	}
+}
+
+// Range calls f for every key-value pair. Like sync.Map.Range, it is not a consistent snapshot and f may use the map.
+func (m *SyncMap[K, V]) Range(f func(key K, value V) bool) {
+	m.data.Range(func(key, val any) bool {
+		return f(key.(K), val.(*syncEntry[V]).v)
+	})
+}
+
+// Len returns the number of keys in the map. It is exact when there is no concurrent write.
+func (m *SyncMap[K, V]) Len() int {
+	return int(m.len.Load())
+}
+
+// All returns an iterator over the map. Like sync.Map.Range, the iteration is weakly consistent and never copies
+// the map: a key written during the iteration may or may not be seen.
+func (m *SyncMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.data.Range(func(key, val any) bool {
+			return yield(key.(K), val.(*syncEntry[V]).v)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys of the map, weakly consistent like All.
+func (m *SyncMap[K, V]) Keys() iter.Seq[K] {
+	return keysOf(m.All())
+}
+
+// Values returns an iterator over the values of the map, weakly consistent like All.
+func (m *SyncMap[K, V]) Values() iter.Seq[V] {
+	return valuesOf(m.All())
+}
+
+// Snapshot writes the key-value pairs seen by Range. The sync.Map has no lock, so it is not a point-in-time
+// snapshot: the writes during the snapshot may or may not be in it.
+func (m *SyncMap[K, V]) Snapshot(w io.Writer) error {
+	var entries []snapshotEntry[K, V]
+	m.data.Range(func(key, val any) bool {
+		entries = append(entries, snapshotEntry[K, V]{Key: key.(K), Value: val.(*syncEntry[V]).v})
+		return true
+	})
+	return writeSnapshot(w, len(entries), slices.Values(entries))
+}
+
+// Restore replaces the content of the map with a snapshot. The keys are deleted and stored one by one,
+// so concurrent readers may see a partially restored map.
+func (m *SyncMap[K, V]) Restore(r io.Reader) error {
+	entries, err := readSnapshot[K, V](r)
+	if err != nil {
+		return err
+	}
+	m.data.Range(func(key, _ any) bool {
+		m.Delete(key.(K))
+		return true
+	})
+	for _, e := range entries {
+		m.Set(e.Key, e.Value)
+	}
+	return nil
 }
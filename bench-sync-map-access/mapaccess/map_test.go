@@ -0,0 +1,361 @@
+package mapaccess
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The benchmarks run every workload against every map with the configurations below.
+// A new map is added to `benchMaps` and a new workload to `benchWorkloads`.
+
+// benchMap creates a map for a benchmark.
+type benchMap struct {
+	name string
+	new  func() Map[string, any]
+}
+
+var benchMaps = []benchMap{
+	{"LockMap", func() Map[string, any] { return NewLockMap() }},
+	{"RWLockMap", func() Map[string, any] { return NewRWLockMap() }},
+	{"SyncMap", func() Map[string, any] { return NewSyncMap() }},
+	{"ShardedMap", func() Map[string, any] { return NewShardedMap[string, any]() }},
+	{"TTLMap", func() Map[string, any] { return NewTTLMap(benchTTL, CacheOptions[string, any]{}) }},
+	{"ShardedTTLMap", func() Map[string, any] { return NewTTLMap(benchTTL, CacheOptions[string, any]{Shards: benchShards}) }},
+	{"LRUMap", func() Map[string, any] { return NewLRUMap(benchCapacity, CacheOptions[string, any]{}) }},
+	{"ShardedLRUMap", func() Map[string, any] {
+		return NewLRUMap(benchCapacity, CacheOptions[string, any]{Shards: benchShards})
+	}},
+	{"COWMap", func() Map[string, any] { return NewCOWMap() }},
+}
+
+// readMostlyMaps copy the whole map on every write, so they only run the read-only workloads
+// and the mixed workloads with at least 99% of reads (see BenchmarkWriteRatio for their crossover).
+var readMostlyMaps = map[string]bool{"COWMap": true}
+
+// readMostlyRatio is the minimum read ratio of the mixed workloads run on the readMostlyMaps.
+const readMostlyRatio = 0.99
+
+// The caches never expire during a benchmark and the LRU maps hold half of the default key space
+// (so the workloads on 10000 keys evict entries).
+const (
+	benchTTL      = time.Hour
+	benchCapacity = 5000
+)
+
+var benchShards = 4 * runtime.GOMAXPROCS(0)
+
+// benchConfig is the key space and the access pattern of a benchmark.
+type benchConfig struct {
+	keys      int     // number of distinct keys
+	readRatio float64 // share of reads in the mixed read/write workloads (GetSetMixed)
+	zipf      float64 // Zipfian skew of the keys (s > 1, a higher s hits fewer keys), 0 for uniform keys
+}
+
+// name returns the name of the sub-benchmark (the read ratio is only part of the name of the mixed workloads)
+func (c benchConfig) name(mixed bool) string {
+	name := "keys=" + strconv.Itoa(c.keys)
+	if mixed {
+		name += fmt.Sprintf("/reads=%g%%", c.readRatio*100)
+	}
+	if c.zipf > 0 {
+		return name + "/zipf=" + strconv.FormatFloat(c.zipf, 'g', -1, 64)
+	}
+	return name + "/uniform"
+}
+
+var benchConfigs = []benchConfig{
+	{keys: 10000, readRatio: 0.5},
+	{keys: 10000, readRatio: 0.9},
+	{keys: 10000, readRatio: 0.9, zipf: 1.1},
+	{keys: 100, readRatio: 0.99},
+	{keys: 100000, readRatio: 0.9, zipf: 1.1},
+}
+
+// benchWorkload is a single operation of a benchmark. `prefill` fills the map before the timer starts,
+// `mixed` workloads run with every read ratio and `readOnly` workloads never write.
+type benchWorkload struct {
+	name     string
+	prefill  bool
+	mixed    bool
+	readOnly bool
+	op       func(m Map[string, any], k *benchKeys, p *keyPicker)
+}
+
+var benchWorkloads = []benchWorkload{
+	{"Set", false, false, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		i := p.next()
+		m.Set(k.keys[i], k.values[i])
+	}},
+	{"Get", true, false, true, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		m.Get(k.keys[p.next()])
+	}},
+	{"Delete", true, false, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		m.Delete(k.keys[p.next()])
+	}},
+	{"SetGet", false, false, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		i := p.next()
+		m.Set(k.keys[i], k.values[i])
+		m.Get(k.keys[i])
+	}},
+	{"GetMixed", true, false, true, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		// half existing keys and half non-existing keys
+		if i := p.next(); p.rnd.IntN(2) == 0 {
+			m.Get(k.keys[i])
+		} else {
+			m.Get(k.missing[i])
+		}
+	}},
+	{"LoadOrStore", true, false, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		i := p.next()
+		m.LoadOrStore(k.keys[i], k.values[i])
+	}},
+	{"Update", true, false, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		m.Update(k.keys[p.next()], func(old any, ok bool) any { return old })
+	}},
+	{"GetSetMixed", true, true, false, func(m Map[string, any], k *benchKeys, p *keyPicker) {
+		i := p.next()
+		if p.rnd.Float64() < p.readRatio {
+			m.Get(k.keys[i])
+		} else {
+			m.Set(k.keys[i], k.values[i])
+		}
+	}},
+}
+
+// benchKeys holds the keys and the values of a key space, so that the benchmarks don't measure their allocation.
+type benchKeys struct {
+	keys    []string
+	missing []string
+	values  []any
+}
+
+var benchKeySpaces = map[int]*benchKeys{}
+
+func newBenchKeys(n int) *benchKeys {
+	if k, ok := benchKeySpaces[n]; ok {
+		return k
+	}
+	k := &benchKeys{
+		keys:    make([]string, n),
+		missing: make([]string, n),
+		values:  make([]any, n),
+	}
+	for i := 0; i < n; i++ {
+		k.keys[i] = "key-" + strconv.Itoa(i)
+		k.missing[i] = "missing-key-" + strconv.Itoa(i)
+		k.values[i] = i
+	}
+	benchKeySpaces[n] = k
+	return k
+}
+
+// keyPicker picks the keys of a goroutine, uniformly or with a Zipfian distribution.
+type keyPicker struct {
+	rnd       *rand.Rand
+	zipf      *rand.Zipf
+	keys      int
+	readRatio float64
+}
+
+var pickerSeed atomic.Uint64
+
+func newKeyPicker(c benchConfig) *keyPicker {
+	seed := pickerSeed.Add(1)
+	p := &keyPicker{
+		rnd:       rand.New(rand.NewPCG(seed, seed)),
+		keys:      c.keys,
+		readRatio: c.readRatio,
+	}
+	if c.zipf > 0 {
+		p.zipf = rand.NewZipf(p.rnd, c.zipf, 1, uint64(c.keys-1))
+	}
+	return p
+}
+
+func (p *keyPicker) next() int {
+	if p.zipf != nil {
+		return int(p.zipf.Uint64())
+	}
+	return p.rnd.IntN(p.keys)
+}
+
+// BenchmarkMaps runs every workload against every map with every configuration,
+// e.g. `go test -bench 'Maps/GetSetMixed/ShardedMap'`.
+func BenchmarkMaps(b *testing.B) {
+	for _, w := range benchWorkloads {
+		b.Run(w.name, func(b *testing.B) {
+			for _, bm := range benchMaps {
+				seen := map[string]bool{}
+				for _, c := range benchConfigs {
+					name := c.name(w.mixed)
+					if seen[name] {
+						continue // the read ratio only changes the mixed workloads
+					}
+					seen[name] = true
+					if readMostlyMaps[bm.name] && !w.readOnly && (!w.mixed || c.readRatio < readMostlyRatio) {
+						continue
+					}
+					b.Run(bm.name+"/"+name, func(b *testing.B) {
+						runBenchmark(b, bm.new(), w, c)
+					})
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWriteRatio runs the GetSetMixed workload with a growing share of writes to show the crossover point
+// of the read-mostly maps.
+func BenchmarkWriteRatio(b *testing.B) {
+	var w benchWorkload
+	for _, bw := range benchWorkloads {
+		if bw.name == "GetSetMixed" {
+			w = bw
+		}
+	}
+	for _, bm := range benchMaps {
+		switch bm.name {
+		case "COWMap", "SyncMap", "RWLockMap", "ShardedMap":
+		default:
+			continue
+		}
+		for _, writes := range []float64{0, 0.0001, 0.001, 0.01, 0.1} {
+			c := benchConfig{keys: 1000, readRatio: 1 - writes}
+			b.Run(fmt.Sprintf("%s/writes=%g%%", bm.name, writes*100), func(b *testing.B) {
+				runBenchmark(b, bm.new(), w, c)
+			})
+		}
+	}
+}
+
+// runBenchmark runs a workload on a map from all the goroutines of the benchmark and reports the latency percentiles
+// and the mutex wait time (see map_metrics_test.go).
+func runBenchmark(b *testing.B, m Map[string, any], w benchWorkload, c benchConfig) {
+	if closer, ok := m.(interface{ Close() }); ok {
+		defer closer.Close() // stop the background goroutine of the TTL maps
+	}
+	k := newBenchKeys(c.keys)
+	if w.prefill {
+		prefill(m, k)
+	}
+	var latencies latencyRecorder
+	b.ReportAllocs()
+	waited := mutexWait()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		p := newKeyPicker(c)
+		var h histogram
+		for n := 0; pb.Next(); n++ {
+			if n%latencySample != 0 {
+				w.op(m, k, p)
+				continue
+			}
+			start := time.Now()
+			w.op(m, k, p)
+			h.record(time.Since(start))
+		}
+		latencies.add(&h)
+	})
+	b.StopTimer()
+	reportMutexWait(b, waited)
+	latencies.report(b)
+}
+
+// prefill sets all the keys of a key space. The COWMap copies the whole map on every Set, so it is filled
+// with a single Batch.
+func prefill(m Map[string, any], k *benchKeys) {
+	if cow, ok := m.(*COWMap[string, any]); ok {
+		cow.Batch(func(data map[string]any) {
+			for i := range k.keys {
+				data[k.keys[i]] = k.values[i]
+			}
+		})
+		return
+	}
+	for i := range k.keys {
+		m.Set(k.keys[i], k.values[i])
+	}
+}
+
+// boxingMap creates the boxed (string/any) and the generic (string/int) version of a map.
+type boxingMap struct {
+	name     string
+	newBoxed func() Map[string, any]
+	newTyped func() Map[string, int]
+}
+
+// boxed creates the boxed map, it is closed when the test or the benchmark ends.
+func (bm boxingMap) boxed(tb testing.TB) Map[string, any] {
+	return closeOnCleanup(tb, bm.newBoxed())
+}
+
+// typed creates the generic map, it is closed when the test or the benchmark ends.
+func (bm boxingMap) typed(tb testing.TB) Map[string, int] {
+	return closeOnCleanup(tb, bm.newTyped())
+}
+
+// closeOnCleanup stops the background goroutine of a TTL map when the test or the benchmark ends.
+func closeOnCleanup[M any](tb testing.TB, m M) M {
+	if closer, ok := any(m).(interface{ Close() }); ok {
+		tb.Cleanup(closer.Close)
+	}
+	return m
+}
+
+var boxingMaps = []boxingMap{
+	{"LockMap", func() Map[string, any] { return NewLockMap() }, func() Map[string, int] { return NewLockMapOf[string, int]() }},
+	{"RWLockMap", func() Map[string, any] { return NewRWLockMap() }, func() Map[string, int] { return NewRWLockMapOf[string, int]() }},
+	{"SyncMap", func() Map[string, any] { return NewSyncMap() }, func() Map[string, int] { return NewSyncMapOf[string, int]() }},
+	{"ShardedMap", func() Map[string, any] { return NewShardedMap[string, any]() }, func() Map[string, int] { return NewShardedMap[string, int]() }},
+	{"TTLMap", func() Map[string, any] { return NewTTLMap(benchTTL, CacheOptions[string, any]{}) }, func() Map[string, int] { return NewTTLMap(benchTTL, CacheOptions[string, int]{}) }},
+	{"LRUMap", func() Map[string, any] { return NewLRUMap(benchCapacity, CacheOptions[string, any]{}) }, func() Map[string, int] { return NewLRUMap(benchCapacity, CacheOptions[string, int]{}) }},
+	{"COWMap", func() Map[string, any] { return NewCOWMap() }, func() Map[string, int] { return NewCOWMapOf[string, int]() }},
+}
+
+// boxedOffset keeps the values out of the small integers that the runtime boxes without allocating.
+const boxedOffset = 1 << 20
+
+// BenchmarkBoxing compares the allocations of a Set and a Get of an int with the boxed and the generic maps.
+// The boxed maps allocate the `any` value on every Set and need a type assertion on every Get.
+// The SyncMap still boxes internally (sync.Map stores `any`).
+func BenchmarkBoxing(b *testing.B) {
+	c := benchConfig{keys: 10000}
+	k := newBenchKeys(c.keys)
+	for _, bm := range boxingMaps {
+		b.Run(bm.name+"/boxed", func(b *testing.B) {
+			m := bm.boxed(b)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				p := newKeyPicker(c)
+				sum := 0
+				for pb.Next() {
+					i := p.next()
+					m.Set(k.keys[i], i+boxedOffset)
+					if v, ok := m.Get(k.keys[i]); ok {
+						sum += v.(int)
+					}
+				}
+			})
+		})
+		b.Run(bm.name+"/generic", func(b *testing.B) {
+			m := bm.typed(b)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				p := newKeyPicker(c)
+				sum := 0
+				for pb.Next() {
+					i := p.next()
+					m.Set(k.keys[i], i+boxedOffset)
+					if v, ok := m.Get(k.keys[i]); ok {
+						sum += v
+					}
+				}
+			})
+		})
+	}
+}
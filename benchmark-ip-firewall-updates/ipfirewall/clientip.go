@@ -0,0 +1,95 @@
+package ipfirewall
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+/****************/
+/*   Client IP  */
+/****************/
+
+// ErrInvalidClientIP is returned when the address of a client can't be extracted
+var ErrInvalidClientIP = errors.New("ipfirewall: invalid client ip")
+
+// ClientIPFunc extracts the address of the client from a request
+type ClientIPFunc func(r *http.Request) (netip.Addr, error)
+
+// RemoteAddrIP returns the address of the peer of the connection (i.e. `http.Request.RemoteAddr`)
+func RemoteAddrIP(r *http.Request) (netip.Addr, error) {
+	return addrFromString(r.RemoteAddr)
+}
+
+// ForwardedForIP returns a ClientIPFunc that trusts the `X-Forwarded-For` header only when the request comes from
+// a trusted proxy. The header is read from right to left (each proxy appends the address of its peer) and the first
+// address that is not a trusted proxy is the client. Requests from other peers use their remote address.
+func ForwardedForIP(trusted []netip.Prefix) ClientIPFunc {
+	return func(r *http.Request) (netip.Addr, error) {
+		addr, err := RemoteAddrIP(r)
+		if err != nil || !containsAddr(trusted, addr) {
+			return addr, err
+		}
+		var hops []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(h, ",")...)
+		}
+		for idx := len(hops) - 1; idx >= 0; idx-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[idx]))
+			if err != nil {
+				return netip.Addr{}, ErrInvalidClientIP
+			}
+			addr = hop.Unmap()
+			if !containsAddr(trusted, addr) {
+				return addr, nil
+			}
+		}
+		// every hop is a trusted proxy, so the leftmost one is the client
+		return addr, nil
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// addrFromString parses an address with or without a port (like `net.Addr.String()` and `http.Request.RemoteAddr`)
+func addrFromString(s string) (netip.Addr, error) {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	host := s
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, ErrInvalidClientIP
+	}
+	return addr.WithZone("").Unmap(), nil
+}
+
+// addrFromNetAddr returns the IP address of a net.Addr (like the remote address of a connection)
+func addrFromNetAddr(a net.Addr) (netip.Addr, error) {
+	switch v := a.(type) {
+	case *net.TCPAddr:
+		return v.AddrPort().Addr().Unmap(), nil
+	case *net.UDPAddr:
+		return v.AddrPort().Addr().Unmap(), nil
+	case nil:
+		return netip.Addr{}, ErrInvalidClientIP
+	}
+	return addrFromString(a.String())
+}
+
+// containsAddr reports whether any of the prefixes contains the address
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package ipfirewall
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/****************/
+/*   Collector  */
+/****************/
+
+// Collector exports the counters of a firewall as Prometheus metrics.
+// The values are read when the metrics are scraped, so the hot path only increments the sharded counters.
+type Collector struct {
+	fw        *IPFirewall
+	decisions *prometheus.Desc
+	ruleHits  *prometheus.Desc
+	version   *prometheus.Desc
+}
+
+// NewCollector creates a collector for a firewall. It must be registered with a prometheus.Registerer.
+func NewCollector(fw *IPFirewall) *Collector {
+	return &Collector{
+		fw: fw,
+		decisions: prometheus.NewDesc(
+			"ipfirewall_decisions_total",
+			"The number of decisions made by the firewall.",
+			[]string{"mode", "verdict"}, nil,
+		),
+		ruleHits: prometheus.NewDesc(
+			"ipfirewall_rule_hits_total",
+			"The number of decisions made by a rule of the firewall.",
+			[]string{"cidr", "verdict"}, nil,
+		),
+		version: prometheus.NewDesc(
+			"ipfirewall_version",
+			"The version of the current snapshot of the firewall.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.decisions
+	ch <- c.ruleHits
+	ch <- c.version
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range []FWMode{ModeDisabled, ModeAllow, ModeBlock} {
+		for _, v := range []Verdict{VerdictAllow, VerdictDeny} {
+			ch <- prometheus.MustNewConstMetric(c.decisions, prometheus.CounterValue, float64(c.fw.Decisions(m, v)), m.String(), v.String())
+		}
+	}
+	for _, h := range c.fw.RuleHits() {
+		cidr := h.Rule.String()
+		ch <- prometheus.MustNewConstMetric(c.ruleHits, prometheus.CounterValue, float64(h.Allowed), cidr, VerdictAllow.String())
+		ch <- prometheus.MustNewConstMetric(c.ruleHits, prometheus.CounterValue, float64(h.Denied), cidr, VerdictDeny.String())
+	}
+	ch <- prometheus.MustNewConstMetric(c.version, prometheus.GaugeValue, float64(c.fw.ReadVersion()))
+}
@@ -0,0 +1,179 @@
+package ipfirewall
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync/atomic"
+)
+
+/****************/
+/*    Counter   */
+/****************/
+
+// maxCounterShards limits the memory used by a counter on machines with a lot of CPUs
+const maxCounterShards = 64
+
+// cacheLinePad is the size of the padding so that every shard uses its own cache line (no false sharing)
+const cacheLinePad = 64 - 8
+
+type paddedCounter struct {
+	n atomic.Uint64
+	_ [cacheLinePad]byte
+}
+
+// shardedCounter is a counter split into one shard per CPU (roughly) to avoid contention on the hot path.
+// Writers pick a random shard with the per-CPU random generator of the runtime, readers sum all the shards.
+type shardedCounter struct {
+	shards []paddedCounter
+	mask   uint32
+}
+
+// counterShards returns the number of shards of a counter: GOMAXPROCS rounded up to a power of two
+func counterShards() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) && n < maxCounterShards {
+		n <<= 1
+	}
+	return n
+}
+
+func newShardedCounter() *shardedCounter {
+	n := counterShards()
+	return &shardedCounter{
+		shards: make([]paddedCounter, n),
+		mask:   uint32(n - 1),
+	}
+}
+
+// Inc increments the counter. It does not allocate or lock.
+func (c *shardedCounter) Inc() {
+	if c.mask == 0 {
+		c.shards[0].n.Add(1)
+		return
+	}
+	c.shards[rand.Uint32()&c.mask].n.Add(1)
+}
+
+// Load returns the sum of all the shards. It is not a point-in-time value while writers are running.
+func (c *shardedCounter) Load() uint64 {
+	var sum uint64
+	for idx := range c.shards {
+		sum += c.shards[idx].n.Load()
+	}
+	return sum
+}
+
+/****************/
+/*     Stats    */
+/****************/
+
+// ruleContentionThreshold is the number of contended increments after which the counters of a rule are sharded
+const ruleContentionThreshold = 64
+
+// ruleCounterShard is a shard of the counters of a hot rule, it uses its own cache line
+type ruleCounterShard struct {
+	allowed atomic.Uint64
+	denied  atomic.Uint64
+	_       [cacheLinePad - 8]byte
+}
+
+func (c *ruleCounterShard) counter(v Verdict) *atomic.Uint64 {
+	if v == VerdictAllow {
+		return &c.allowed
+	}
+	return &c.denied
+}
+
+// ruleCounters are the hit counters of a rule. They are shared by every snapshot containing the rule,
+// so the counters are kept when other rules are added or removed.
+// A firewall can have 100k rules, so the counters of a rule start unsharded in a single cache line.
+// They are sharded lazily: an increment that loses a race with another CPU is counted as contended and
+// the shards are allocated once a rule is hot (e.g. a single rule matching most of the traffic).
+type ruleCounters struct {
+	allowed   atomic.Uint64
+	denied    atomic.Uint64
+	contended atomic.Uint32
+	shards    atomic.Pointer[[]ruleCounterShard]
+	_         [cacheLinePad - 24]byte
+}
+
+func newRuleCounters() *ruleCounters {
+	return &ruleCounters{}
+}
+
+func (c *ruleCounters) inc(v Verdict) {
+	if shards := c.shards.Load(); shards != nil {
+		s := *shards
+		s[rand.Uint32()&uint32(len(s)-1)].counter(v).Add(1)
+		return
+	}
+	n := &c.denied
+	if v == VerdictAllow {
+		n = &c.allowed
+	}
+	if old := n.Load(); n.CompareAndSwap(old, old+1) {
+		return
+	}
+	n.Add(1)
+	if c.contended.Add(1) == ruleContentionThreshold {
+		c.shard()
+	}
+}
+
+// shard allocates the shards of the counters. The counts made before are kept in the base counters.
+func (c *ruleCounters) shard() {
+	shards := make([]ruleCounterShard, counterShards())
+	c.shards.Store(&shards)
+}
+
+// load returns the sum of the base counters and of the shards
+func (c *ruleCounters) load() (allowed, denied uint64) {
+	allowed, denied = c.allowed.Load(), c.denied.Load()
+	if shards := c.shards.Load(); shards != nil {
+		for idx := range *shards {
+			allowed += (*shards)[idx].allowed.Load()
+			denied += (*shards)[idx].denied.Load()
+		}
+	}
+	return allowed, denied
+}
+
+// decisionCounters count the verdicts of the firewall for every mode
+type decisionCounters [3][2]*shardedCounter
+
+func newDecisionCounters() *decisionCounters {
+	d := &decisionCounters{}
+	for m := range d {
+		for v := range d[m] {
+			d[m][v] = newShardedCounter()
+		}
+	}
+	return d
+}
+
+// RuleHits are the number of decisions made by a rule
+type RuleHits struct {
+	Rule    Rule
+	Allowed uint64
+	Denied  uint64
+}
+
+// RuleHits returns the hit counters of the rules in the current snapshot
+func (i *IPFirewall) RuleHits() []RuleHits {
+	s := i.snapshot.Load()
+	hits := make([]RuleHits, len(s.rules))
+	for idx, r := range s.rules {
+		allowed, denied := r.counters.load()
+		hits[idx] = RuleHits{
+			Rule:    r,
+			Allowed: allowed,
+			Denied:  denied,
+		}
+	}
+	return hits
+}
+
+// Decisions returns the number of verdicts made by the firewall in a mode
+func (i *IPFirewall) Decisions(m FWMode, v Verdict) uint64 {
+	return i.decisions[m][v].Load()
+}
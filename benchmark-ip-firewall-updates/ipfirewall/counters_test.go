@@ -0,0 +1,202 @@
+package ipfirewall
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestShardedCounter(t *testing.T) {
+	const goroutines = 16
+	const increments = 10000
+
+	c := newShardedCounter()
+	wg := &sync.WaitGroup{}
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; n++ {
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Load() != goroutines*increments {
+		t.Fatalf("TestShardedCounter: Expected `%d`. Found `%d`.", goroutines*increments, c.Load())
+	}
+}
+
+// TestRuleCountersSize checks that the counters of a rule fit in a cache line, so large lists stay small
+func TestRuleCountersSize(t *testing.T) {
+	if size := unsafe.Sizeof(ruleCounters{}); size != 64 {
+		t.Fatalf("TestRuleCountersSize: Expected `64` bytes. Found `%d`.", size)
+	}
+}
+
+func TestRuleCountersSharding(t *testing.T) {
+	const goroutines = 16
+	const increments = 10000
+
+	c := newRuleCounters()
+	run := func() {
+		wg := &sync.WaitGroup{}
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(v Verdict) {
+				defer wg.Done()
+				for n := 0; n < increments; n++ {
+					c.inc(v)
+				}
+			}(Verdict(g % 2))
+		}
+		wg.Wait()
+	}
+	run()
+	// the shards are allocated when the rule is contended, force them so both paths are counted
+	if c.shards.Load() == nil {
+		c.shard()
+	}
+	run()
+
+	allowed, denied := c.load()
+	if expected := uint64(goroutines * increments); allowed != expected || denied != expected {
+		t.Fatalf("TestRuleCountersSharding: Expected `%d` and `%d`. Found `%d` and `%d`.", expected, expected, allowed, denied)
+	}
+}
+
+func TestRuleHits(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8", "10.66.0.0/16")); err != nil {
+		t.Fatalf("TestRuleHits: %s", err)
+	}
+	ip.Decide(netip.MustParseAddr("10.1.1.1"))
+	ip.Decide(netip.MustParseAddr("10.66.1.1"))
+	ip.Decide(netip.MustParseAddr("10.66.1.2"))
+	ip.Decide(netip.MustParseAddr("192.0.2.1"))
+
+	expectRuleHits(t, ip, map[string]uint64{"10.0.0.0/8": 1, "10.66.0.0/16": 2})
+	if ip.Decisions(ModeBlock, VerdictDeny) != 3 || ip.Decisions(ModeBlock, VerdictAllow) != 1 {
+		t.Fatalf("TestRuleHits: Unexpected decisions. Denied `%d`. Allowed `%d`.", ip.Decisions(ModeBlock, VerdictDeny), ip.Decisions(ModeBlock, VerdictAllow))
+	}
+
+	// the counters of the remaining rules are kept by the updates (even when the list is replaced)
+	if err := ip.SetIPList(mustParseIPList(t, "10.66.0.0/16", "192.0.2.0/24")); err != nil {
+		t.Fatalf("TestRuleHits: %s", err)
+	}
+	ip.Decide(netip.MustParseAddr("192.0.2.1"))
+	expectRuleHits(t, ip, map[string]uint64{"10.66.0.0/16": 2, "192.0.2.0/24": 1})
+}
+
+func TestCollector(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8")); err != nil {
+		t.Fatalf("TestCollector: %s", err)
+	}
+	ip.Decide(netip.MustParseAddr("10.1.1.1"))
+	ip.Decide(netip.MustParseAddr("192.0.2.1"))
+
+	expected := `
+# HELP ipfirewall_decisions_total The number of decisions made by the firewall.
+# TYPE ipfirewall_decisions_total counter
+ipfirewall_decisions_total{mode="allow",verdict="allow"} 1
+ipfirewall_decisions_total{mode="allow",verdict="deny"} 1
+ipfirewall_decisions_total{mode="block/deny",verdict="allow"} 0
+ipfirewall_decisions_total{mode="block/deny",verdict="deny"} 0
+ipfirewall_decisions_total{mode="disabled",verdict="allow"} 0
+ipfirewall_decisions_total{mode="disabled",verdict="deny"} 0
+# HELP ipfirewall_rule_hits_total The number of decisions made by a rule of the firewall.
+# TYPE ipfirewall_rule_hits_total counter
+ipfirewall_rule_hits_total{cidr="10.0.0.0/8",verdict="allow"} 1
+ipfirewall_rule_hits_total{cidr="10.0.0.0/8",verdict="deny"} 0
+# HELP ipfirewall_version The version of the current snapshot of the firewall.
+# TYPE ipfirewall_version gauge
+ipfirewall_version 1
+`
+	if err := testutil.CollectAndCompare(NewCollector(ip), strings.NewReader(expected)); err != nil {
+		t.Fatalf("TestCollector: %s", err)
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+func expectRuleHits(t *testing.T, ip *IPFirewall, expected map[string]uint64) {
+	t.Helper()
+	hits := ip.RuleHits()
+	if len(hits) != len(expected) {
+		t.Fatalf("Unexpected rule hits. Expected `%v`. Found `%v`.", expected, hits)
+	}
+	for _, h := range hits {
+		if h.Allowed+h.Denied != expected[h.Rule.String()] {
+			t.Fatalf("Unexpected hits for `%s`. Expected `%d`. Found `%d`.", h.Rule, expected[h.Rule.String()], h.Allowed+h.Denied)
+		}
+	}
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+// Counter Benchmarks (compare with the integer benchmarks in ipf_test.go)
+
+func BenchmarkShardedCounter(b *testing.B) {
+	c := newShardedCounter()
+	for i := 0; i < b.N; i++ {
+		c.Inc()
+	}
+}
+
+func BenchmarkParallelShardedCounter(b *testing.B) {
+	c := newShardedCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+func BenchmarkParallelSharedAtomicCounter(b *testing.B) {
+	c := &atomic.Uint64{}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(1)
+		}
+	})
+}
+
+func BenchmarkParallelSharedMutexCounter(b *testing.B) {
+	lck := &sync.Mutex{}
+	var c uint64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lck.Lock()
+			c += 1
+			lck.Unlock()
+		}
+	})
+}
+
+func BenchmarkParallelDecideSameRule(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(b, "10.0.0.0/8")); err != nil {
+		b.Fatal(err)
+	}
+	addr := netip.MustParseAddr("10.1.1.1")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ip.Decide(addr)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package ipfirewall
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+)
+
+/****************/
+/*     Diff     */
+/****************/
+
+// Overlap is a pair of prefixes where one of them contains the other
+type Overlap struct {
+	Prefix netip.Prefix
+	Other  netip.Prefix
+}
+
+// ActionChange is a prefix of both lists with a different action
+type ActionChange struct {
+	Prefix netip.Prefix
+	Old    Action
+	New    Action
+}
+
+// RuleSetDiff is the difference between two lists of rules
+type RuleSetDiff struct {
+	Added   []netip.Prefix
+	Removed []netip.Prefix
+	// Changed are the prefixes of both lists whose action has changed
+	Changed []ActionChange
+	// Overlapping are the added prefixes (Prefix) that contain or are contained by a prefix of the old list (Other)
+	Overlapping []Overlap
+	// Shadowed are the rules of the new list (Prefix) whose nearest broader rule of the new list (Other) is a permanent
+	// rule with the same action. They don't change any verdict and can be removed.
+	Shadowed []Overlap
+}
+
+// Diff compares two lists of prefixes (e.g. the live rules with `Snapshot.Prefixes` and a new blocklist).
+// The prefixes follow the mode of the firewall (see DiffRules).
+func Diff(old, new []netip.Prefix) *RuleSetDiff {
+	return DiffRules(modeRules(old), modeRules(new))
+}
+
+// DiffRules compares two lists of rules (e.g. `Snapshot.Rules` before and after an update) by prefix and action.
+// The prefixes are masked before they are compared and invalid prefixes are ignored (the first rule of a duplicate
+// prefix is kept). The results are sorted.
+func DiffRules(old, new []Rule) *RuleSetDiff {
+	old, new = canonicalRules(old), canonicalRules(new)
+	oldSet := make(map[netip.Prefix]Action, len(old))
+	for _, r := range old {
+		oldSet[r.Prefix] = r.Action
+	}
+	newSet := make(map[netip.Prefix]Action, len(new))
+	for _, r := range new {
+		newSet[r.Prefix] = r.Action
+	}
+
+	sortRules(old)
+	sortRules(new)
+
+	d := &RuleSetDiff{}
+	for _, r := range new {
+		a, ok := oldSet[r.Prefix]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, r.Prefix)
+		case a != r.Action:
+			d.Changed = append(d.Changed, ActionChange{Prefix: r.Prefix, Old: a, New: r.Action})
+		}
+	}
+	for _, r := range old {
+		if _, ok := newSet[r.Prefix]; !ok {
+			d.Removed = append(d.Removed, r.Prefix)
+		}
+	}
+
+	// an added prefix inside an old prefix
+	oldPrefixes := rulePrefixes(old)
+	oldTree := newIPTree(oldPrefixes)
+	for _, p := range d.Added {
+		if idx := oldTree.lookupCovering(p, p.Bits()-1); idx != noRule {
+			d.Overlapping = append(d.Overlapping, Overlap{Prefix: p, Other: oldPrefixes[idx]})
+		}
+	}
+	// an old prefix inside an added prefix
+	addedTree := newIPTree(d.Added)
+	for _, o := range oldPrefixes {
+		if idx := addedTree.lookupCovering(o, o.Bits()-1); idx != noRule {
+			d.Overlapping = append(d.Overlapping, Overlap{Prefix: d.Added[idx], Other: o})
+		}
+	}
+	sortOverlaps(d.Overlapping)
+
+	// only the nearest broader rule decides, so a rule inside a rule with another action (e.g. an explicit allow
+	// inside a deny) is never shadowed
+	newTree := newIPTree(rulePrefixes(new))
+	for _, r := range new {
+		idx := newTree.lookupCovering(r.Prefix, r.Prefix.Bits()-1)
+		if idx != noRule && !new[idx].IsTemporary() && new[idx].Action == r.Action {
+			d.Shadowed = append(d.Shadowed, Overlap{Prefix: r.Prefix, Other: new[idx].Prefix})
+		}
+	}
+	return d
+}
+
+// Prefixes returns the prefixes of the rules in the snapshot
+func (s *Snapshot) Prefixes() []netip.Prefix {
+	return rulePrefixes(s.rules)
+}
+
+/****************/
+/*    Dry Run   */
+/****************/
+
+// dryRunSamples is the number of changed decisions kept by a dry run
+const dryRunSamples = 128
+
+// DryRunChange is a decision that would be changed by the rules of a dry run
+type DryRunChange struct {
+	Addr   netip.Addr
+	Live   Verdict
+	Shadow Verdict
+}
+
+// DryRunReport is the impact of the rules of a dry run on the live traffic
+type DryRunReport struct {
+	Version      uint64 // version of the live snapshot used to build the shadow rules
+	Evaluated    uint64 // number of decisions evaluated with the shadow rules
+	NewlyDenied  uint64 // allowed by the live rules and denied by the shadow rules
+	NewlyAllowed uint64 // denied by the live rules and allowed by the shadow rules
+	Samples      []DryRunChange
+}
+
+// dryRun evaluates a shadow snapshot next to the live snapshot
+type dryRun struct {
+	shadow       *Snapshot
+	baseVersion  uint64
+	evaluated    *shardedCounter
+	newlyDenied  *shardedCounter
+	newlyAllowed *shardedCounter
+
+	samplesLock *sync.Mutex
+	samples     []DryRunChange // ring buffer
+	next        int
+}
+
+// StartDryRun evaluates new rules in shadow: the update function receives a copy of the current rules (like Update)
+// and every decision of the firewall is also made with the new rules without enforcing them.
+// The decisions that would change are reported by DryRunReport. A running dry run is replaced.
+func (i *IPFirewall) StartDryRun(update func(*RuleSet) error) error {
+	cur := i.snapshot.Load()
+	rs := newRuleSet(cur.mode, cur.rules)
+	if err := update(rs); err != nil {
+		return err
+	}
+	i.dryRun.Store(&dryRun{
+		shadow:       buildSnapshot(shadowRules(rs.Rules()), rs.mode, cur.version),
+		baseVersion:  cur.version,
+		evaluated:    newShardedCounter(),
+		newlyDenied:  newShardedCounter(),
+		newlyAllowed: newShardedCounter(),
+		samplesLock:  &sync.Mutex{},
+		samples:      make([]DryRunChange, 0, dryRunSamples),
+	})
+	return nil
+}
+
+// StopDryRun stops the dry run and returns its final report
+func (i *IPFirewall) StopDryRun() DryRunReport {
+	d := i.dryRun.Swap(nil)
+	if d == nil {
+		return DryRunReport{}
+	}
+	return d.report()
+}
+
+// DryRunReport returns the report of the running dry run (or an empty report)
+func (i *IPFirewall) DryRunReport() DryRunReport {
+	d := i.dryRun.Load()
+	if d == nil {
+		return DryRunReport{}
+	}
+	return d.report()
+}
+
+// DryRunDiff compares the live rules with the rules of the running dry run
+func (i *IPFirewall) DryRunDiff() *RuleSetDiff {
+	d := i.dryRun.Load()
+	if d == nil {
+		return &RuleSetDiff{}
+	}
+	return DiffRules(i.snapshot.Load().rules, d.shadow.rules)
+}
+
+// evaluate compares a live decision with the shadow snapshot. The hot path only increments counters; a changed
+// decision is sampled if the samples are not being written by another reader (it never waits for the lock).
+func (d *dryRun) evaluate(addr netip.Addr, live Verdict) {
+	d.evaluated.Inc()
+	shadow := d.shadow.Decide(addr)
+	if shadow == live {
+		return
+	}
+	if shadow == VerdictDeny {
+		d.newlyDenied.Inc()
+	} else {
+		d.newlyAllowed.Inc()
+	}
+	if !d.samplesLock.TryLock() {
+		return
+	}
+	change := DryRunChange{Addr: addr, Live: live, Shadow: shadow}
+	if len(d.samples) < dryRunSamples {
+		d.samples = append(d.samples, change)
+	} else {
+		d.samples[d.next] = change
+	}
+	d.next = (d.next + 1) % dryRunSamples
+	d.samplesLock.Unlock()
+}
+
+func (d *dryRun) report() DryRunReport {
+	d.samplesLock.Lock()
+	samples := append([]DryRunChange(nil), d.samples...)
+	d.samplesLock.Unlock()
+	return DryRunReport{
+		Version:      d.baseVersion,
+		Evaluated:    d.evaluated.Load(),
+		NewlyDenied:  d.newlyDenied.Load(),
+		NewlyAllowed: d.newlyAllowed.Load(),
+		Samples:      samples,
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// shadowRules drops the hit counters of the rules, so the shadow snapshot never shares the counters of the live rules
+// (and, built with buildSnapshot, never allocates counters)
+func shadowRules(rules []Rule) []Rule {
+	for idx := range rules {
+		rules[idx].counters = nil
+	}
+	return rules
+}
+
+// modeRules converts a list of prefixes into rules that follow the mode of the firewall
+func modeRules(prefixes []netip.Prefix) []Rule {
+	rules := make([]Rule, len(prefixes))
+	for idx, p := range prefixes {
+		rules[idx] = Rule{Prefix: p}
+	}
+	return rules
+}
+
+// canonicalRules returns a copy of the rules with masked prefixes and without the invalid and duplicate prefixes
+func canonicalRules(rules []Rule) []Rule {
+	seen := make(map[netip.Prefix]bool, len(rules))
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		if p, ok := canonicalPrefix(r.Prefix); ok && !seen[p] {
+			seen[p] = true
+			r.Prefix = p
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func rulePrefixes(rules []Rule) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(rules))
+	for idx, r := range rules {
+		prefixes[idx] = r.Prefix
+	}
+	return prefixes
+}
+
+func sortPrefixes(p []netip.Prefix) {
+	sort.Slice(p, func(a, b int) bool {
+		return comparePrefix(p[a], p[b]) < 0
+	})
+}
+
+func sortRules(r []Rule) {
+	sort.Slice(r, func(a, b int) bool {
+		return comparePrefix(r[a].Prefix, r[b].Prefix) < 0
+	})
+}
+
+func sortOverlaps(o []Overlap) {
+	sort.Slice(o, func(a, b int) bool {
+		if c := comparePrefix(o[a].Prefix, o[b].Prefix); c != 0 {
+			return c < 0
+		}
+		return comparePrefix(o[a].Other, o[b].Other) < 0
+	})
+}
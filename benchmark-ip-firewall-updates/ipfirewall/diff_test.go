@@ -0,0 +1,211 @@
+package ipfirewall
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestDiff(t *testing.T) {
+	old := mustParsePrefixes(t, "10.0.0.0/8", "192.168.1.0/24", "203.0.113.0/24", "2001:db8::/32")
+	new := mustParsePrefixes(t, "10.0.0.0/8", "10.1.0.0/16", "192.168.0.0/16", "2001:db8::/32", "2001:db8:1::/48", "198.51.100.7/32")
+	d := Diff(old, new)
+
+	expected := []struct {
+		name  string
+		found fmt.Stringer
+		value string
+	}{
+		{"Added", prefixList(d.Added), "[10.1.0.0/16 192.168.0.0/16 198.51.100.7/32 2001:db8:1::/48]"},
+		{"Removed", prefixList(d.Removed), "[192.168.1.0/24 203.0.113.0/24]"},
+		{"Overlapping", overlapList(d.Overlapping), "[10.1.0.0/16>10.0.0.0/8 192.168.0.0/16>192.168.1.0/24 2001:db8:1::/48>2001:db8::/32]"},
+		{"Shadowed", overlapList(d.Shadowed), "[10.1.0.0/16>10.0.0.0/8 2001:db8:1::/48>2001:db8::/32]"},
+	}
+	for _, e := range expected {
+		if e.found.String() != e.value {
+			t.Fatalf("TestDiff: %s: Expected `%s`. Found `%s`.", e.name, e.value, e.found)
+		}
+	}
+
+	// identical lists and unmasked prefixes
+	d = Diff(mustParsePrefixes(t, "10.0.0.0/8"), []netip.Prefix{netip.MustParsePrefix("10.1.2.3/8")})
+	if len(d.Added)+len(d.Removed)+len(d.Changed)+len(d.Overlapping)+len(d.Shadowed) != 0 {
+		t.Fatalf("TestDiff: Unexpected diff `%+v`.", d)
+	}
+}
+
+// TestDiffRules checks that the actions are compared: a changed action is reported and a rule is only shadowed
+// by a broader rule with the same action
+func TestDiffRules(t *testing.T) {
+	rule := func(cidr string, a Action) Rule {
+		return Rule{Prefix: netip.MustParsePrefix(cidr), Action: a}
+	}
+	old := []Rule{rule("10.0.0.0/8", ActionDeny), rule("192.168.0.0/16", ActionMode)}
+	new := []Rule{
+		rule("10.0.0.0/8", ActionDeny),
+		rule("10.1.0.0/16", ActionAllow), // explicit allow inside a deny: not shadowed
+		rule("10.1.2.0/24", ActionAllow), // inside the allow: shadowed
+		rule("10.2.0.0/16", ActionDeny),  // inside the deny: shadowed
+		rule("192.168.0.0/16", ActionAllow),
+	}
+	d := DiffRules(old, new)
+
+	if found := prefixList(d.Added).String(); found != "[10.1.0.0/16 10.1.2.0/24 10.2.0.0/16]" {
+		t.Fatalf("TestDiffRules: Added: Unexpected `%s`.", found)
+	}
+	expected := ActionChange{Prefix: netip.MustParsePrefix("192.168.0.0/16"), Old: ActionMode, New: ActionAllow}
+	if len(d.Removed) != 0 || len(d.Changed) != 1 || d.Changed[0] != expected {
+		t.Fatalf("TestDiffRules: Unexpected changes. Removed `%v`. Changed `%v`.", d.Removed, d.Changed)
+	}
+	if found := overlapList(d.Shadowed).String(); found != "[10.1.2.0/24>10.1.0.0/16 10.2.0.0/16>10.0.0.0/8]" {
+		t.Fatalf("TestDiffRules: Shadowed: Unexpected `%s`.", found)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8", "192.168.1.0/24")); err != nil {
+		t.Fatalf("TestDryRun: %s", err)
+	}
+	if err := ip.StartDryRun(func(rs *RuleSet) error {
+		rs.Remove(netip.MustParsePrefix("192.168.1.0/24"))
+		return rs.AddCIDR("203.0.113.0/24")
+	}); err != nil {
+		t.Fatalf("TestDryRun: %s", err)
+	}
+
+	decisions := []struct {
+		addr    string
+		verdict Verdict
+	}{
+		{"10.1.1.1", VerdictDeny},     // unchanged
+		{"192.168.1.1", VerdictDeny},  // newly allowed
+		{"203.0.113.1", VerdictAllow}, // newly denied
+		{"203.0.113.2", VerdictAllow}, // newly denied
+		{"8.8.8.8", VerdictAllow},     // unchanged
+	}
+	for _, d := range decisions {
+		if v := ip.Decide(netip.MustParseAddr(d.addr)); v != d.verdict {
+			t.Fatalf("TestDryRun: The dry run is enforced for `%s`. Expected `%s`. Found `%s`.", d.addr, d.verdict, v)
+		}
+	}
+
+	r := ip.DryRunReport()
+	if r.Evaluated != 5 || r.NewlyDenied != 2 || r.NewlyAllowed != 1 || r.Version != ip.ReadVersion() {
+		t.Fatalf("TestDryRun: Unexpected report `%+v`.", r)
+	}
+	expected := DryRunChange{Addr: netip.MustParseAddr("192.168.1.1"), Live: VerdictDeny, Shadow: VerdictAllow}
+	if len(r.Samples) != 3 || r.Samples[0] != expected {
+		t.Fatalf("TestDryRun: Unexpected samples `%v`.", r.Samples)
+	}
+	if diff := ip.DryRunDiff(); prefixList(diff.Added).String() != "[203.0.113.0/24]" || prefixList(diff.Removed).String() != "[192.168.1.0/24]" {
+		t.Fatalf("TestDryRun: Unexpected diff `%+v`.", diff)
+	}
+
+	// the shadow decisions are not counted as rule hits and the shadow rules have no counters
+	for _, h := range ip.RuleHits() {
+		if h.Rule.String() == "10.0.0.0/8" && h.Denied != 1 {
+			t.Fatalf("TestDryRun: Expected `1` hit. Found `%d`.", h.Denied)
+		}
+	}
+	for _, r := range ip.dryRun.Load().shadow.rules {
+		if r.counters != nil {
+			t.Fatalf("TestDryRun: Unexpected counters for the shadow rule `%s`.", r)
+		}
+	}
+
+	if r := ip.StopDryRun(); r.Evaluated != 5 {
+		t.Fatalf("TestDryRun: Unexpected final report `%+v`.", r)
+	}
+	ip.Decide(netip.MustParseAddr("203.0.113.1"))
+	if r := ip.DryRunReport(); r.Evaluated != 0 {
+		t.Fatalf("TestDryRun: The dry run is still running `%+v`.", r)
+	}
+}
+
+func TestDryRunSamples(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.StartDryRun(func(rs *RuleSet) error { return rs.AddCIDR("10.0.0.0/8") }); err != nil {
+		t.Fatalf("TestDryRunSamples: %s", err)
+	}
+	for n := 0; n < 3*dryRunSamples; n++ {
+		ip.Decide(testAddr(n))
+	}
+	r := ip.StopDryRun()
+	if r.NewlyAllowed != 3*dryRunSamples || len(r.Samples) != dryRunSamples {
+		t.Fatalf("TestDryRunSamples: Expected `%d` samples. Found `%d` (`%d` changes).", dryRunSamples, len(r.Samples), r.NewlyAllowed)
+	}
+}
+
+func TestDecideDuringDryRunDoesNotAllocate(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8")); err != nil {
+		t.Fatalf("TestDecideDuringDryRunDoesNotAllocate: %s", err)
+	}
+	if err := ip.StartDryRun(func(rs *RuleSet) error { return rs.AddCIDR("192.168.0.0/16") }); err != nil {
+		t.Fatalf("TestDecideDuringDryRunDoesNotAllocate: %s", err)
+	}
+	addr := netip.MustParseAddr("192.168.1.1")
+	if n := testing.AllocsPerRun(1000, func() { ip.Decide(addr) }); n != 0 {
+		t.Fatalf("TestDecideDuringDryRunDoesNotAllocate: Expected `0` allocations. Found `%v`.", n)
+	}
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+func BenchmarkParallelDecideDuringDryRun(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(b, "10.0.0.0/8")); err != nil {
+		b.Fatal(err)
+	}
+	if err := ip.StartDryRun(func(rs *RuleSet) error { return rs.AddCIDR("10.128.0.0/9") }); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := 0
+		for pb.Next() {
+			ip.Decide(testAddr(n))
+			n++
+		}
+	})
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+type prefixList []netip.Prefix
+
+func (l prefixList) String() string {
+	return fmt.Sprint([]netip.Prefix(l))
+}
+
+type overlapList []Overlap
+
+func (l overlapList) String() string {
+	s := make([]string, len(l))
+	for idx, o := range l {
+		s[idx] = o.Prefix.String() + ">" + o.Other.String()
+	}
+	return fmt.Sprint(s)
+}
+
+func mustParsePrefixes(tb testing.TB, cidrs ...string) []netip.Prefix {
+	tb.Helper()
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for idx, c := range cidrs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		prefixes[idx] = p
+	}
+	return prefixes
+}
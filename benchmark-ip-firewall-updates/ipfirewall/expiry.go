@@ -0,0 +1,83 @@
+package ipfirewall
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+/****************/
+/*    Expiry    */
+/****************/
+
+// TemporaryRule is an active temporary rule with its remaining time to live
+type TemporaryRule struct {
+	Rule Rule
+	TTL  time.Duration
+}
+
+// AddTemporary adds a prefix with an action to the firewall for a duration, e.g. to block a network for 30 minutes
+// during an incident with ActionDeny. The rule is removed by the janitor after it expires (see RunJanitor).
+// ErrPermanentRule is returned if the prefix already has a permanent rule.
+func (i *IPFirewall) AddTemporary(p netip.Prefix, a Action, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	expires := time.Now().Add(ttl)
+	return i.Update(func(rs *RuleSet) error {
+		return rs.AddUntil(p, a, expires)
+	})
+}
+
+// TemporaryRules returns the temporary rules that have not expired yet, sorted by their remaining time to live
+func (i *IPFirewall) TemporaryRules() []TemporaryRule {
+	now := time.Now()
+	var rules []TemporaryRule
+	for _, r := range i.snapshot.Load().rules {
+		if r.IsTemporary() && !r.isExpired(now) {
+			rules = append(rules, TemporaryRule{Rule: r, TTL: r.Expires.Sub(now)})
+		}
+	}
+	sort.SliceStable(rules, func(a, b int) bool {
+		return rules[a].TTL < rules[b].TTL
+	})
+	return rules
+}
+
+// RemoveExpired removes the temporary rules that have expired at a given time with a single update
+// and returns the number of removed rules. The firewall is not updated (and the version is kept) if nothing has expired.
+func (i *IPFirewall) RemoveExpired(now time.Time) (int, error) {
+	if !i.snapshot.Load().hasExpired(now) {
+		return 0, nil
+	}
+	removed := 0
+	err := i.Update(func(rs *RuleSet) error {
+		removed = rs.RemoveExpired(now)
+		return nil
+	})
+	return removed, err
+}
+
+// RunJanitor removes the expired rules at every interval until the context is done.
+// The lookups never check the expiry of the rules (so they don't need a clock or a lock); an expired rule is
+// enforced until the next run of the janitor, so the interval is the precision of the expiry.
+func (i *IPFirewall) RunJanitor(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if _, err := i.RemoveExpired(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// hasExpired reports whether the snapshot contains a rule that has expired at a given time
+func (s *Snapshot) hasExpired(now time.Time) bool {
+	return !s.nextExpiry.IsZero() && !now.Before(s.nextExpiry)
+}
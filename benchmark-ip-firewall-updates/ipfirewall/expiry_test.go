@@ -0,0 +1,129 @@
+package ipfirewall
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestAddTemporary(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8")); err != nil {
+		t.Fatalf("TestAddTemporary: %s", err)
+	}
+	if err := ip.AddTemporary(netip.MustParsePrefix("203.0.113.0/24"), ActionDeny, 30*time.Minute); err != nil {
+		t.Fatalf("TestAddTemporary: %s", err)
+	}
+	if err := ip.AddTemporary(netip.MustParsePrefix("198.51.100.0/24"), ActionDeny, time.Minute); err != nil {
+		t.Fatalf("TestAddTemporary: %s", err)
+	}
+	if err := ip.AddTemporary(netip.MustParsePrefix("198.51.100.0/24"), ActionDeny, 0); err != ErrInvalidTTL {
+		t.Fatalf("TestAddTemporary: Expected `%v`. Found `%v`.", ErrInvalidTTL, err)
+	}
+	if ip.Decide(netip.MustParseAddr("203.0.113.1")) != VerdictDeny {
+		t.Fatalf("TestAddTemporary: The temporary rule is not enforced.")
+	}
+
+	// temporary rules are listed with their remaining ttl (shortest first)
+	rules := ip.TemporaryRules()
+	if len(rules) != 2 || rules[0].Rule.String() != "198.51.100.0/24" || rules[1].Rule.String() != "203.0.113.0/24" {
+		t.Fatalf("TestAddTemporary: Unexpected temporary rules `%v`.", rules)
+	}
+	if rules[1].TTL <= 29*time.Minute || rules[1].TTL > 30*time.Minute {
+		t.Fatalf("TestAddTemporary: Unexpected ttl `%s`.", rules[1].TTL)
+	}
+
+	// a temporary rule does not replace a permanent rule
+	if err := ip.AddTemporary(netip.MustParsePrefix("10.0.0.0/8"), ActionDeny, time.Minute); err != ErrPermanentRule {
+		t.Fatalf("TestAddTemporary: Expected `%v`. Found `%v`.", ErrPermanentRule, err)
+	}
+	if len(ip.TemporaryRules()) != 2 {
+		t.Fatalf("TestAddTemporary: The permanent rule was made temporary.")
+	}
+
+	// the action of a temporary rule does not depend on the mode: a temporary deny rule blocks in an allowlist
+	ip.SetMode(ModeAllow)
+	if ip.Decide(netip.MustParseAddr("203.0.113.1")) != VerdictDeny || ip.Decide(netip.MustParseAddr("10.1.1.1")) != VerdictAllow {
+		t.Fatalf("TestAddTemporary: The temporary rule follows the mode.")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	now := time.Now()
+	if err := ip.Update(func(rs *RuleSet) error {
+		if err := rs.AddCIDR("10.0.0.0/8"); err != nil {
+			return err
+		}
+		if err := rs.AddUntil(netip.MustParsePrefix("203.0.113.0/24"), ActionDeny, now.Add(time.Minute)); err != nil {
+			return err
+		}
+		return rs.AddUntil(netip.MustParsePrefix("198.51.100.0/24"), ActionDeny, now.Add(time.Hour))
+	}); err != nil {
+		t.Fatalf("TestRemoveExpired: %s", err)
+	}
+
+	// nothing has expired, so the firewall is not updated
+	if removed, err := ip.RemoveExpired(now); err != nil || removed != 0 || ip.ReadVersion() != 1 {
+		t.Fatalf("TestRemoveExpired: Unexpected update. Removed `%d`. Version `%d`. Error `%v`.", removed, ip.ReadVersion(), err)
+	}
+	if removed, err := ip.RemoveExpired(now.Add(2 * time.Minute)); err != nil || removed != 1 || ip.ReadVersion() != 2 {
+		t.Fatalf("TestRemoveExpired: Unexpected update. Removed `%d`. Version `%d`. Error `%v`.", removed, ip.ReadVersion(), err)
+	}
+	if ip.Decide(netip.MustParseAddr("203.0.113.1")) != VerdictAllow || ip.Decide(netip.MustParseAddr("198.51.100.1")) != VerdictDeny {
+		t.Fatalf("TestRemoveExpired: Unexpected rules after expiry `%v`.", ip.IPList())
+	}
+	if removed, _ := ip.RemoveExpired(now.Add(2 * time.Hour)); removed != 1 || len(ip.IPList()) != 1 {
+		t.Fatalf("TestRemoveExpired: Unexpected rules after expiry `%v`.", ip.IPList())
+	}
+}
+
+func TestRunJanitor(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.AddTemporary(netip.MustParsePrefix("203.0.113.0/24"), ActionDeny, 20*time.Millisecond); err != nil {
+		t.Fatalf("TestRunJanitor: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ip.RunJanitor(ctx, 5*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ip.Decide(netip.MustParseAddr("203.0.113.1")) == VerdictDeny {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestRunJanitor: The expired rule was not removed.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(ip.TemporaryRules()) != 0 || len(ip.IPList()) != 0 {
+		t.Fatalf("TestRunJanitor: Unexpected rules `%v`.", ip.IPList())
+	}
+}
+
+func TestLoaderKeepsTemporaryRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRulesFile(t, path, "10.0.0.0/8\n198.51.100.0/24\n")
+
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.AddTemporary(netip.MustParsePrefix("203.0.113.0/24"), ActionDeny, time.Hour); err != nil {
+		t.Fatalf("TestLoaderKeepsTemporaryRules: %s", err)
+	}
+	// a prefix of the file that is a temporary rule keeps its action and its expiry
+	if err := ip.AddTemporary(netip.MustParsePrefix("198.51.100.0/24"), ActionAllow, time.Hour); err != nil {
+		t.Fatalf("TestLoaderKeepsTemporaryRules: %s", err)
+	}
+	if err := NewLoader(ip, path).Load(); err != nil {
+		t.Fatalf("TestLoaderKeepsTemporaryRules: %s", err)
+	}
+	if len(ip.TemporaryRules()) != 2 || len(ip.IPList()) != 3 {
+		t.Fatalf("TestLoaderKeepsTemporaryRules: Unexpected rules `%v`.", ip.IPList())
+	}
+	if ip.Decide(netip.MustParseAddr("198.51.100.1")) != VerdictAllow {
+		t.Fatalf("TestLoaderKeepsTemporaryRules: The temporary rule was replaced by the file.")
+	}
+}
@@ -1,7 +1,11 @@
 package ipfirewall
 
 import (
+	"errors"
 	"net"
+	"net/netip"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -26,49 +30,225 @@ func (f FWMode) String() string {
 	return [...]string{disabledStr, allowStr, blockStr}[f]
 }
 
+// ParseFWMode converts a string (`disabled`, `allow`, `block` or `deny`) into a mode
+func ParseFWMode(s string) (FWMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case disabledStr:
+		return ModeDisabled, nil
+	case allowStr:
+		return ModeAllow, nil
+	case "block", "deny", blockStr:
+		return ModeBlock, nil
+	}
+	return ModeDisabled, ErrInvalidMode
+}
+
+// valid reports whether the mode is one of the modes above
+func (f FWMode) valid() bool {
+	return f >= ModeDisabled && f <= ModeBlock
+}
+
+/****************/
+/*    Verdict   */
+/****************/
+
+// Verdict is the decision of the firewall for a single IP address
+type Verdict int
+
+const (
+	VerdictAllow Verdict = iota
+	VerdictDeny
+)
+
+const (
+	verdictAllowStr = "allow"
+	verdictDenyStr  = "deny"
+)
+
+func (v Verdict) String() string {
+	return [...]string{verdictAllowStr, verdictDenyStr}[v]
+}
+
 /****************/
 /*  IPFirewall  */
 /****************/
 
+// ErrInvalidNetwork is returned when a network can not be converted into a CIDR prefix
+var ErrInvalidNetwork = errors.New("ipfirewall: invalid network")
+
+// ErrInvalidMode is returned when a string is not a valid mode
+var ErrInvalidMode = errors.New("ipfirewall: invalid mode")
+
+// ErrInvalidTTL is returned when a temporary rule does not have a positive time to live
+var ErrInvalidTTL = errors.New("ipfirewall: invalid ttl")
+
+// ErrPermanentRule is returned when a temporary rule is added for a prefix that has a permanent rule
+var ErrPermanentRule = errors.New("ipfirewall: prefix has a permanent rule")
+
 // IPFirewall is a dummy data structure containing some allow lists and some block lists
 // Since this is a POC we use a list of CIDR IP addresses. It is not necessary for IP ranges to fall into a single subnet.
-// A better structure for this approach is probably a radix tree/ip tree
+// The mode, the rules, the lookup tree (a radix tree/ip tree) and the version number are stored in an immutable snapshot
+// that is swapped with a single atomic store (copy-on-write). Readers never lock, writers are serialized with a mutex.
 type IPFirewall struct {
-	ipList                *atomic.Pointer[[]net.IPNet]
-	mode                  FWMode
+	snapshot              *atomic.Pointer[Snapshot]
+	writeLock             *sync.Mutex
+	decisions             *decisionCounters
+	dryRun                *atomic.Pointer[dryRun]
 	versionNumber         *atomic.Uint64
 	versionNumberUintType uint64 // for Golang versions before 1.19
 }
 
 // NewIPFirewall creates a new IP Firewall with a given mode
 func NewIPFirewall() *IPFirewall {
-	return &IPFirewall{
+	i := &IPFirewall{
+		snapshot:      &atomic.Pointer[Snapshot]{},
+		writeLock:     &sync.Mutex{},
+		decisions:     newDecisionCounters(),
+		dryRun:        &atomic.Pointer[dryRun]{},
 		versionNumber: &atomic.Uint64{},
 	}
+	i.snapshot.Store(newSnapshot(nil, ModeDisabled, 0))
+	return i
 }
 
-// NewIPFirewall creates a new IP Firewall with a given mode
+// NewIPFirewallWithMode creates a new IP Firewall with a given mode. An unknown mode disables the firewall.
 func NewIPFirewallWithMode(m FWMode) *IPFirewall {
+	if !m.valid() {
+		m = ModeDisabled
+	}
 	i := NewIPFirewall()
-	i.mode = m
+	i.snapshot.Store(newSnapshot(nil, m, 0))
 	return i
 }
 
 // IsActive checks if the firewall is either in allow mode or deny mode
 func (i *IPFirewall) IsActive() bool {
-	return i.mode != ModeDisabled
+	return i.Mode() != ModeDisabled
+}
+
+// Mode returns the current mode of the firewall
+func (i *IPFirewall) Mode() FWMode {
+	return i.snapshot.Load().mode
+}
+
+// SetMode atomically changes the mode of the firewall (e.g. from an allowlist to a blocklist) and increments the version.
+// The mode is part of the snapshot, so the readers always see it together with the matching rules.
+// It returns ErrInvalidMode for an unknown mode (and the firewall is not changed).
+func (i *IPFirewall) SetMode(m FWMode) error {
+	if !m.valid() {
+		return ErrInvalidMode
+	}
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+
+	cur := i.snapshot.Load()
+	i.store(cur.withMode(m, cur.version+1))
+	return nil
+}
+
+// Snapshot returns the current snapshot of the firewall. The snapshot never changes, so a reader can use it
+// to make several decisions with the same rules and version.
+func (i *IPFirewall) Snapshot() *Snapshot {
+	return i.snapshot.Load()
+}
+
+// Update builds a new snapshot of the firewall. The update function receives a copy of the current rules (and mode)
+// and the new snapshot (with an incremented version) is swapped in only if the function returns no error.
+// Updates are serialized and do not block the readers.
+func (i *IPFirewall) Update(update func(*RuleSet) error) error {
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+
+	cur := i.snapshot.Load()
+	rs := newRuleSet(cur.mode, cur.rules)
+	if err := update(rs); err != nil {
+		return err
+	}
+	i.store(newSnapshot(rs.Rules(), rs.mode, cur.version+1))
+	return nil
+}
+
+// SetIPList replaces the list of networks used by the firewall and increments the version.
+func (i *IPFirewall) SetIPList(list []net.IPNet) error {
+	return i.Update(func(rs *RuleSet) error {
+		rs.Reset()
+		for idx := range list {
+			p, ok := prefixFromIPNet(&list[idx])
+			if !ok {
+				return ErrInvalidNetwork
+			}
+			if err := rs.Add(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IPList returns the list of networks currently used by the firewall
+func (i *IPFirewall) IPList() []net.IPNet {
+	rules := i.snapshot.Load().rules
+	list := make([]net.IPNet, len(rules))
+	for idx, r := range rules {
+		list[idx] = ipNetFromPrefix(r.Prefix)
+	}
+	return list
+}
+
+// Decide returns the verdict of the current snapshot of the firewall for an address (see Snapshot.Decide).
+// The decision is counted per mode and verdict, and per matching rule, and compared with the rules of a running dry run.
+func (i *IPFirewall) Decide(addr netip.Addr) Verdict {
+	_, _, v := i.decide(addr)
+	if d := i.dryRun.Load(); d != nil {
+		d.evaluate(addr, v)
+	}
+	return v
+}
+
+// decide returns the counted verdict of the current snapshot with the snapshot and the matching rule
+func (i *IPFirewall) decide(addr netip.Addr) (*Snapshot, int, Verdict) {
+	s := i.snapshot.Load()
+	if s.mode == ModeDisabled {
+		i.decisions[ModeDisabled][VerdictAllow].Inc()
+		return s, noRule, VerdictAllow
+	}
+	rule := s.tree.lookup(addr)
+	v := s.verdict(rule)
+	i.decisions[s.mode][v].Inc()
+	if rule != noRule {
+		s.rules[rule].counters.inc(v)
+	}
+	return s, rule, v
+}
+
+// Allow reports whether the firewall allows an IP address.
+// Invalid addresses never match a network, so they are denied by an allowlist and allowed by a blocklist.
+func (i *IPFirewall) Allow(ip net.IP) bool {
+	addr, _ := netip.AddrFromSlice(ip) // an invalid address is the zero value
+	return i.Decide(addr) == VerdictAllow
 }
 
 // IncVersion is a thread-safe way to increment the version number of the Firewall mode.
-// Note that the version must be incremented after mode updates or updates to the ipList (but not before the updates)
+// It swaps in a copy of the current snapshot (with the same rules) and a new version number.
 func (i *IPFirewall) IncVersion() {
-	i.versionNumber.Add(1)
-	atomic.AddUint64(&i.versionNumberUintType, 1)
+	i.writeLock.Lock()
+	defer i.writeLock.Unlock()
+
+	cur := i.snapshot.Load()
+	i.store(cur.withVersion(cur.version + 1))
+}
+
+// store swaps in a new snapshot. The plain version numbers are updated after the swap (since they are only
+// used as hints by the readers). It must be called with the write lock held.
+func (i *IPFirewall) store(s *Snapshot) {
+	i.snapshot.Store(s)
+	i.versionNumber.Store(s.version)
+	atomic.StoreUint64(&i.versionNumberUintType, s.version)
 }
 
-// ReadVersion reads the version number using atomic instructions.
+// ReadVersion reads the version number of the current snapshot using atomic instructions.
 func (i *IPFirewall) ReadVersion() uint64 {
-	return i.versionNumber.Load()
+	return i.snapshot.Load().version
 }
 
 // ReadEventuallyConsistentVersion reads the version number without using atomic instructions.
@@ -2,7 +2,9 @@ package ipfirewall
 
 import (
 	"context"
+	"errors"
 	"net"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -16,7 +18,7 @@ import (
 func TestNewIPFirewallIsActive(t *testing.T) {
 	i := NewIPFirewall()
 	if i.IsActive() {
-		t.Fatalf("TestNewIPFirewallIsActive: The default state of the firewall must be `%s`. Found `%s`.", disabledStr, i.mode)
+		t.Fatalf("TestNewIPFirewallIsActive: The default state of the firewall must be `%s`. Found `%s`.", disabledStr, i.Mode())
 	}
 }
 
@@ -34,10 +36,230 @@ func TestVersionIncrements(t *testing.T) {
 	}
 }
 
+func TestDecide(t *testing.T) {
+	list := mustParseIPList(t, "10.0.0.0/8", "192.0.2.0/24", "2001:db8::/32")
+
+	tests := []struct {
+		mode     FWMode
+		addr     string
+		expected Verdict
+	}{
+		{ModeDisabled, "10.0.0.1", VerdictAllow},
+		{ModeDisabled, "198.51.100.1", VerdictAllow},
+		{ModeAllow, "10.0.0.1", VerdictAllow},
+		{ModeAllow, "2001:db8::1", VerdictAllow},
+		{ModeAllow, "198.51.100.1", VerdictDeny},
+		{ModeAllow, "2001:db9::1", VerdictDeny},
+		{ModeBlock, "192.0.2.200", VerdictDeny},
+		{ModeBlock, "::ffff:192.0.2.200", VerdictDeny},
+		{ModeBlock, "198.51.100.1", VerdictAllow},
+	}
+	for _, tc := range tests {
+		ip := NewIPFirewallWithMode(tc.mode)
+		if err := ip.SetIPList(list); err != nil {
+			t.Fatalf("TestDecide: %s", err)
+		}
+		if v := ip.Decide(netip.MustParseAddr(tc.addr)); v != tc.expected {
+			t.Fatalf("TestDecide: Unexpected verdict for `%s` in mode `%s`. Expected `%s`. Found `%s`.", tc.addr, tc.mode, tc.expected, v)
+		}
+		if allowed := ip.Allow(net.ParseIP(tc.addr)); allowed != (tc.expected == VerdictAllow) {
+			t.Fatalf("TestDecide: Unexpected result of Allow for `%s` in mode `%s`. Found `%t`.", tc.addr, tc.mode, allowed)
+		}
+	}
+}
+
+func TestDecideWithoutIPList(t *testing.T) {
+	if v := NewIPFirewallWithMode(ModeAllow).Decide(netip.MustParseAddr("10.0.0.1")); v != VerdictDeny {
+		t.Fatalf("TestDecideWithoutIPList: An empty allowlist must deny everything. Found `%s`.", v)
+	}
+	if v := NewIPFirewallWithMode(ModeBlock).Decide(netip.MustParseAddr("10.0.0.1")); v != VerdictAllow {
+		t.Fatalf("TestDecideWithoutIPList: An empty blocklist must allow everything. Found `%s`.", v)
+	}
+}
+
+func TestSetIPList(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	list := mustParseIPList(t, "10.0.0.0/8")
+	if err := ip.SetIPList(list); err != nil {
+		t.Fatalf("TestSetIPList: %s", err)
+	}
+	if ip.ReadVersion() != 1 {
+		t.Fatalf("TestSetIPList: The version must be incremented after the update. Found `%d`.", ip.ReadVersion())
+	}
+	// modifying the input must not modify the firewall
+	list[0] = mustParseIPList(t, "192.0.2.0/24")[0]
+	if got := ip.IPList()[0].String(); got != "10.0.0.0/8" {
+		t.Fatalf("TestSetIPList: The list of the firewall was modified by the caller. Found `%s`.", got)
+	}
+	// invalid networks are rejected
+	if err := ip.SetIPList([]net.IPNet{{IP: net.IP{1, 2}, Mask: net.CIDRMask(8, 32)}}); err != ErrInvalidNetwork {
+		t.Fatalf("TestSetIPList: Expected `%v`. Found `%v`.", ErrInvalidNetwork, err)
+	}
+}
+
+func TestDecideDoesNotAllocate(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8", "2001:db8::/32")); err != nil {
+		t.Fatalf("TestDecideDoesNotAllocate: %s", err)
+	}
+	addr := netip.MustParseAddr("2001:db8::1")
+	nip := net.ParseIP("10.1.1.1")
+	allocs := testing.AllocsPerRun(1000, func() {
+		ip.Decide(addr)
+		ip.Allow(nip)
+	})
+	if allocs != 0 {
+		t.Fatalf("TestDecideDoesNotAllocate: Expected no allocations. Found `%f`.", allocs)
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8")); err != nil {
+		t.Fatalf("TestSetMode: %s", err)
+	}
+	addr := netip.MustParseAddr("10.1.1.1")
+	if ip.Decide(addr) != VerdictAllow {
+		t.Fatalf("TestSetMode: `%s` must be allowed by the allowlist.", addr)
+	}
+
+	ip.SetMode(ModeBlock)
+	if ip.Mode() != ModeBlock || ip.ReadVersion() != 2 {
+		t.Fatalf("TestSetMode: Unexpected mode `%s` and version `%d`.", ip.Mode(), ip.ReadVersion())
+	}
+	if ip.Decide(addr) != VerdictDeny {
+		t.Fatalf("TestSetMode: `%s` must be denied by the blocklist.", addr)
+	}
+
+	// the rules are kept when the mode changes and the mode is kept when the rules change
+	if len(ip.IPList()) != 1 {
+		t.Fatalf("TestSetMode: The rules were changed by SetMode. Found `%v`.", ip.IPList())
+	}
+	if err := ip.SetIPList(mustParseIPList(t, "192.0.2.0/24")); err != nil {
+		t.Fatalf("TestSetMode: %s", err)
+	}
+	if ip.Mode() != ModeBlock {
+		t.Fatalf("TestSetMode: The mode was changed by SetIPList. Found `%s`.", ip.Mode())
+	}
+
+	ip.SetMode(ModeDisabled)
+	if ip.IsActive() {
+		t.Fatalf("TestSetMode: The firewall must not be active after it is disabled.")
+	}
+
+	// an unknown mode is refused, so the decisions never use it
+	if err := ip.SetMode(FWMode(3)); !errors.Is(err, ErrInvalidMode) {
+		t.Fatalf("TestSetMode: Expected `%s`. Found `%v`.", ErrInvalidMode, err)
+	}
+	if err := ip.Update(func(rs *RuleSet) error { return rs.SetMode(FWMode(-1)) }); !errors.Is(err, ErrInvalidMode) {
+		t.Fatalf("TestSetMode: Expected `%s`. Found `%v`.", ErrInvalidMode, err)
+	}
+	if ip.Mode() != ModeDisabled || ip.Decide(addr) != VerdictAllow {
+		t.Fatalf("TestSetMode: The firewall was changed by an unknown mode. Found `%s`.", ip.Mode())
+	}
+	// a firewall created with an unknown mode is disabled
+	if ip := NewIPFirewallWithMode(FWMode(7)); ip.Mode() != ModeDisabled || ip.Decide(addr) != VerdictAllow {
+		t.Fatalf("TestSetMode: Expected `%s` for an unknown mode. Found `%s`.", ModeDisabled, ip.Mode())
+	}
+}
+
+// TestConcurrentSetMode toggles the mode while readers check that every snapshot has the mode of its version
+func TestConcurrentSetMode(t *testing.T) {
+	const toggles = 5000
+	ip := NewIPFirewall()
+	if err := ip.SetIPList(mustParseIPList(t, "10.0.0.0/8")); err != nil {
+		t.Fatalf("TestConcurrentSetMode: %s", err)
+	}
+	addr := netip.MustParseAddr("10.1.1.1")
+	// odd versions are allowlists and even versions are blocklists
+	expectedVerdict := func(v uint64) Verdict {
+		if v%2 == 1 {
+			return VerdictAllow
+		}
+		return VerdictDeny
+	}
+
+	done := make(chan struct{})
+	failed := &atomic.Bool{}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			s := ip.Snapshot()
+			if s.Version() > 1 && s.Decide(addr) != expectedVerdict(s.Version()) {
+				failed.Store(true)
+				return
+			}
+		}
+	}()
+
+	for n := 2; n <= toggles; n++ {
+		if n%2 == 1 {
+			ip.SetMode(ModeAllow)
+		} else {
+			ip.SetMode(ModeBlock)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if failed.Load() {
+		t.Fatalf("TestConcurrentSetMode: A reader found a snapshot with a mode that does not match its version.")
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+func mustParseIPList(tb testing.TB, cidrs ...string) []net.IPNet {
+	list := make([]net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, ipnet, err := net.ParseCIDR(c)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		list = append(list, *ipnet)
+	}
+	return list
+}
+
 /****************/
 /*  Benchmarks  */
 /****************/
 
+// Decision Benchmarks
+
+func BenchmarkDecide(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(b, "10.0.0.0/8", "10.66.0.0/16", "192.0.2.0/24", "2001:db8::/32")); err != nil {
+		b.Fatal(err)
+	}
+	addr := netip.MustParseAddr("10.66.1.1")
+	for i := 0; i < b.N; i++ {
+		ip.Decide(addr)
+	}
+}
+
+func BenchmarkParallelDecide(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(b, "10.0.0.0/8", "10.66.0.0/16", "192.0.2.0/24", "2001:db8::/32")); err != nil {
+		b.Fatal(err)
+	}
+	addr := netip.MustParseAddr("10.66.1.1")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ip.Decide(addr)
+		}
+	})
+}
+
 // Function Benchmarks
 
 func BenchmarkReadVersion(b *testing.B) {
@@ -0,0 +1,231 @@
+package ipfirewall
+
+import (
+	"math/bits"
+	"net"
+	"net/netip"
+)
+
+/****************/
+/*    uint128   */
+/****************/
+
+// uint128 is an IP address (or a prefix of it) stored as two machine words so that
+// the tree can compare and mask keys without touching the heap.
+// IPv4 keys are left aligned in `lo` (and `hi` is unused) so that they are compared with a single word.
+type uint128 struct {
+	hi uint64
+	lo uint64
+}
+
+// keyFromAddr converts an address into a tree key and the width of its family (32 or 128 bits)
+func keyFromAddr(a netip.Addr) (uint128, int) {
+	if a.Is4() {
+		b := a.As4()
+		return uint128{lo: uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32}, 32
+	}
+	b := a.As16()
+	return uint128{
+		hi: uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32 | uint64(b[4])<<24 | uint64(b[5])<<16 | uint64(b[6])<<8 | uint64(b[7]),
+		lo: uint64(b[8])<<56 | uint64(b[9])<<48 | uint64(b[10])<<40 | uint64(b[11])<<32 | uint64(b[12])<<24 | uint64(b[13])<<16 | uint64(b[14])<<8 | uint64(b[15]),
+	}, 128
+}
+
+// bitAt returns the i-th most significant bit of the key
+func (u uint128) bitAt(i int, width int) int {
+	if width == 32 {
+		return int(u.lo>>(63-i)) & 1
+	}
+	if i < 64 {
+		return int(u.hi>>(63-i)) & 1
+	}
+	return int(u.lo>>(127-i)) & 1
+}
+
+// mask keeps the first n bits of the key and clears the rest
+func (u uint128) mask(n int, width int) uint128 {
+	if width == 32 {
+		if n == 0 {
+			return uint128{}
+		}
+		return uint128{lo: u.lo & (^uint64(0) << (64 - n))}
+	}
+	switch {
+	case n == 0:
+		return uint128{}
+	case n < 64:
+		return uint128{hi: u.hi & (^uint64(0) << (64 - n))}
+	case n == 64:
+		return uint128{hi: u.hi}
+	case n < 128:
+		return uint128{hi: u.hi, lo: u.lo & (^uint64(0) << (128 - n))}
+	}
+	return u
+}
+
+// commonPrefixLen returns the number of leading bits shared by both keys (capped at max)
+func (u uint128) commonPrefixLen(v uint128, max int, width int) int {
+	var n int
+	if width == 32 {
+		n = bits.LeadingZeros64(u.lo ^ v.lo)
+	} else if x := u.hi ^ v.hi; x != 0 {
+		n = bits.LeadingZeros64(x)
+	} else {
+		n = 64 + bits.LeadingZeros64(u.lo^v.lo)
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+/****************/
+/*    ipTree    */
+/****************/
+
+// noRule is the value of the tree nodes that were only created to branch (and do not hold a rule)
+const noRule = -1
+
+// treeNode is a node of a path-compressed binary (patricia) tree.
+// Every node stores the full (masked) prefix so that a lookup only needs to compare it with the address.
+type treeNode struct {
+	key   uint128
+	bits  int          // prefix length
+	rule  int          // index of the rule for this prefix or noRule
+	child [2]*treeNode // next bit after the prefix is 0 or 1
+}
+
+// ipTree is an immutable longest-prefix-match tree for both IPv4 and IPv6 prefixes.
+// It is built once by the writer and is never modified afterwards, so the readers don't need any locks.
+type ipTree struct {
+	v4 *treeNode
+	v6 *treeNode
+}
+
+// newIPTree builds a tree from a list of prefixes. The value stored for each prefix is its index in the list.
+// For duplicate prefixes the last index wins.
+func newIPTree(prefixes []netip.Prefix) *ipTree {
+	t := &ipTree{}
+	for idx, p := range prefixes {
+		t.insert(p, idx)
+	}
+	return t
+}
+
+func (t *ipTree) root(width int) **treeNode {
+	if width == 32 {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// insert adds a prefix to the tree. Invalid prefixes are ignored.
+func (t *ipTree) insert(p netip.Prefix, rule int) {
+	if !p.IsValid() {
+		return
+	}
+	key, width := keyFromAddr(p.Addr())
+	plen := p.Bits()
+	key = key.mask(plen, width)
+
+	n := t.root(width)
+	for {
+		node := *n
+		if node == nil {
+			*n = &treeNode{key: key, bits: plen, rule: rule}
+			return
+		}
+		limit := plen
+		if node.bits < limit {
+			limit = node.bits
+		}
+		common := key.commonPrefixLen(node.key, limit, width)
+		switch {
+		case common == node.bits && common == plen:
+			// same prefix
+			node.rule = rule
+			return
+		case common == node.bits:
+			// the node is a parent of the new prefix
+			n = &node.child[key.bitAt(node.bits, width)]
+		case common == plen:
+			// the new prefix is a parent of the node
+			leaf := &treeNode{key: key, bits: plen, rule: rule}
+			leaf.child[node.key.bitAt(plen, width)] = node
+			*n = leaf
+			return
+		default:
+			// both prefixes diverge after the common bits, so add a branch node
+			branch := &treeNode{key: key.mask(common, width), bits: common, rule: noRule}
+			branch.child[key.bitAt(common, width)] = &treeNode{key: key, bits: plen, rule: rule}
+			branch.child[node.key.bitAt(common, width)] = node
+			*n = branch
+			return
+		}
+	}
+}
+
+// lookup returns the rule index of the longest prefix containing the address or noRule if there is no match.
+// It neither allocates nor locks.
+func (t *ipTree) lookup(a netip.Addr) int {
+	if t == nil || !a.IsValid() {
+		return noRule
+	}
+	a = a.Unmap() // match ::ffff:a.b.c.d with IPv4 rules
+	key, width := keyFromAddr(a)
+	return t.find(key, width, width)
+}
+
+// lookupCovering returns the rule index of the longest prefix containing a prefix with at most maxBits bits
+// (e.g. `p.Bits()-1` to find a broader prefix) or noRule if there is no such prefix.
+func (t *ipTree) lookupCovering(p netip.Prefix, maxBits int) int {
+	if t == nil || !p.IsValid() || maxBits < 0 {
+		return noRule
+	}
+	key, width := keyFromAddr(p.Addr())
+	if maxBits > p.Bits() {
+		maxBits = p.Bits()
+	}
+	return t.find(key.mask(p.Bits(), width), width, maxBits)
+}
+
+// find walks down the tree and returns the last rule on the path of the key with at most maxBits bits
+func (t *ipTree) find(key uint128, width int, maxBits int) int {
+	node := *t.root(width)
+	match := noRule
+	for node != nil && node.bits <= maxBits {
+		if key.mask(node.bits, width) != node.key {
+			break
+		}
+		if node.rule != noRule {
+			match = node.rule
+		}
+		if node.bits == width {
+			break
+		}
+		node = node.child[key.bitAt(node.bits, width)]
+	}
+	return match
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// prefixFromIPNet converts a net.IPNet into a netip.Prefix. IPv4 networks are always unmapped.
+func prefixFromIPNet(n *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, size := n.Mask.Size()
+	if size == 0 {
+		return netip.Prefix{}, false // non-canonical mask
+	}
+	if size == 32 {
+		addr = addr.Unmap()
+	} else if addr.Is4() {
+		return netip.Prefix{}, false // ipv4 address with an ipv6 mask
+	}
+	return netip.PrefixFrom(addr, ones).Masked(), true
+}
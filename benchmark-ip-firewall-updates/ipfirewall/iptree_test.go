@@ -0,0 +1,121 @@
+package ipfirewall
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestIPTreeLongestPrefixMatch(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("10.66.0.0/16"),
+		netip.MustParsePrefix("10.66.1.0/24"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+		netip.MustParsePrefix("::/0"),
+	}
+	tree := newIPTree(prefixes)
+
+	tests := []struct {
+		addr string
+		rule int
+	}{
+		{"10.1.2.3", 0},
+		{"10.66.2.3", 1},
+		{"10.66.1.3", 2},
+		{"192.0.2.1", 3},
+		{"192.0.2.2", noRule},
+		{"11.0.0.1", noRule},
+		{"::ffff:10.66.1.1", 2}, // ipv4-mapped ipv6 addresses match the ipv4 rules
+		{"2001:db8::1", 4},
+		{"2001:db8:ffff::1", 5},
+		{"2001:db9::1", 6},
+	}
+	for _, tc := range tests {
+		if rule := tree.lookup(netip.MustParseAddr(tc.addr)); rule != tc.rule {
+			t.Fatalf("TestIPTreeLongestPrefixMatch: Unexpected rule for `%s`. Expected `%d`. Found `%d`.", tc.addr, tc.rule, rule)
+		}
+	}
+
+	// the zero address and nil trees never match
+	if rule := tree.lookup(netip.Addr{}); rule != noRule {
+		t.Fatalf("TestIPTreeLongestPrefixMatch: The invalid address must not match. Found `%d`.", rule)
+	}
+	var nilTree *ipTree
+	if rule := nilTree.lookup(netip.MustParseAddr("10.0.0.1")); rule != noRule {
+		t.Fatalf("TestIPTreeLongestPrefixMatch: A nil tree must not match. Found `%d`.", rule)
+	}
+}
+
+// TestIPTreeRandom compares the tree with a linear scan over random prefixes and addresses
+func TestIPTreeRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rnd, 2000)
+	tree := newIPTree(prefixes)
+
+	for n := 0; n < 20000; n++ {
+		addr := randomAddr(rnd)
+		expected, best := noRule, -1
+		for idx, p := range prefixes {
+			if p.Contains(addr) && p.Bits() >= best {
+				expected, best = idx, p.Bits()
+			}
+		}
+		if rule := tree.lookup(addr); rule != expected {
+			t.Fatalf("TestIPTreeRandom: Unexpected rule for `%s`. Expected `%d`. Found `%d`.", addr, expected, rule)
+		}
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// randomAddr returns an address from a small part of the address space so that random prefixes overlap
+func randomAddr(rnd *rand.Rand) netip.Addr {
+	if rnd.Intn(2) == 0 {
+		return netip.AddrFrom4([4]byte{10, byte(rnd.Intn(4)), byte(rnd.Intn(256)), byte(rnd.Intn(256))})
+	}
+	var b [16]byte
+	b[0], b[1], b[2], b[3] = 0x20, 0x01, 0x0d, 0xb8
+	b[4] = byte(rnd.Intn(4))
+	rnd.Read(b[5:])
+	return netip.AddrFrom16(b)
+}
+
+func randomPrefixes(rnd *rand.Rand, n int) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, n)
+	for len(prefixes) < n {
+		addr := randomAddr(rnd)
+		bits := 8 + rnd.Intn(25)
+		if addr.Is6() {
+			bits = 32 + rnd.Intn(97)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bits).Masked())
+	}
+	return prefixes
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+func BenchmarkIPTreeLookup(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	tree := newIPTree(randomPrefixes(rnd, 10000))
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rnd)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.lookup(addrs[i%len(addrs)])
+	}
+}
@@ -0,0 +1,183 @@
+package ipfirewall
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+/****************/
+/*   Listener   */
+/****************/
+
+// defaultProxyHeaderTimeout is the time a client has to send its PROXY protocol header
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// Listener is a net.Listener that consults the firewall for every accepted connection.
+// Denied connections are closed before they are returned by Accept.
+type Listener struct {
+	net.Listener
+	fw       *IPFirewall
+	rejected *shardedCounter
+
+	// PROXY protocol
+	proxyProtocol bool
+	trusted       []netip.Prefix
+	headerTimeout time.Duration
+	startOnce     *sync.Once
+	closeOnce     *sync.Once
+	conns         chan net.Conn
+	errs          chan error
+	done          chan struct{}
+}
+
+// NewListener wraps a listener and decides with the remote address of the connections
+func NewListener(l net.Listener, fw *IPFirewall) *Listener {
+	return &Listener{
+		Listener:  l,
+		fw:        fw,
+		rejected:  newShardedCounter(),
+		startOnce: &sync.Once{},
+		closeOnce: &sync.Once{},
+	}
+}
+
+// NewProxyProtocolListener wraps a listener behind a load balancer that sends PROXY protocol (v1 or v2) headers.
+// Connections from the trusted prefixes must start with a header and are decided with the source address of the
+// header, connections from other peers are decided with their remote address. If no prefixes are given, every
+// connection must start with a header. Connections with an invalid header are closed.
+//
+// Headers are read concurrently (with a timeout), so a slow client never blocks Accept for the other clients.
+func NewProxyProtocolListener(l net.Listener, fw *IPFirewall, trusted []netip.Prefix) *Listener {
+	pl := NewListener(l, fw)
+	pl.proxyProtocol = true
+	pl.trusted = trusted
+	pl.headerTimeout = defaultProxyHeaderTimeout
+	pl.conns = make(chan net.Conn)
+	pl.errs = make(chan error)
+	pl.done = make(chan struct{})
+	return pl
+}
+
+// SetProxyHeaderTimeout changes the time a client has to send its PROXY protocol header. It must be called before Accept.
+func (l *Listener) SetProxyHeaderTimeout(d time.Duration) {
+	l.headerTimeout = d
+}
+
+// Accept waits for and returns the next connection allowed by the firewall
+func (l *Listener) Accept() (net.Conn, error) {
+	if l.proxyProtocol {
+		l.startOnce.Do(func() { go l.acceptLoop() })
+		select {
+		case c := <-l.conns:
+			return c, nil
+		case err := <-l.errs:
+			return nil, err
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		addr, _ := addrFromNetAddr(c.RemoteAddr()) // an invalid address is the zero value
+		if l.allow(c, addr) {
+			return c, nil
+		}
+	}
+}
+
+// Close closes the listener. Connections that are still sending their PROXY protocol header are closed.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		if l.done != nil {
+			close(l.done)
+		}
+	})
+	return l.Listener.Close()
+}
+
+// Rejected returns the number of connections rejected by the listener
+func (l *Listener) Rejected() uint64 {
+	return l.rejected.Load()
+}
+
+// allow decides a connection and closes it if it is denied
+func (l *Listener) allow(c net.Conn, addr netip.Addr) bool {
+	if l.fw.Decide(addr) == VerdictAllow {
+		return true
+	}
+	l.rejected.Inc()
+	c.Close()
+	return false
+}
+
+// acceptLoop accepts the connections and reads their PROXY protocol headers in separate goroutines
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(c)
+	}
+}
+
+// handshake reads the PROXY protocol header of a connection and queues it for Accept if it is allowed
+func (l *Listener) handshake(c net.Conn) {
+	addr, _ := addrFromNetAddr(c.RemoteAddr())
+	if len(l.trusted) == 0 || containsAddr(l.trusted, addr) {
+		r := bufio.NewReader(c)
+		c.SetReadDeadline(time.Now().Add(l.headerTimeout))
+		src, err := readProxyHeader(r)
+		if err != nil {
+			l.rejected.Inc()
+			c.Close()
+			return
+		}
+		c.SetReadDeadline(time.Time{})
+		pc := &proxyConn{Conn: c, reader: r, remote: c.RemoteAddr()}
+		if src.IsValid() {
+			addr = src.Addr()
+			pc.remote = net.TCPAddrFromAddrPort(src)
+		}
+		c = pc
+	}
+	if !l.allow(c, addr) {
+		return
+	}
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+// proxyConn is a connection after its PROXY protocol header. The remote address is the address of the client.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader // may hold data sent after the header
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,204 @@
+package ipfirewall
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string // empty for headers that must use the address of the connection
+		invalid  bool
+	}{
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324", false},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{"PROXY TCP4 2001:db8::1 192.0.2.1 56324 443\r\n", "", true},
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n", "", true},
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", "", true},
+		{"PROXY " + strings.Repeat("A", 200) + "\r\n", "", true},
+		{"GET / HTTP/1.1\r\n\r\n", "", true},
+		{string(proxyV2Header(0x21, 0x11, netip.MustParseAddrPort("192.0.2.1:56324"))), "192.0.2.1:56324", false},
+		{string(proxyV2Header(0x21, 0x21, netip.MustParseAddrPort("[2001:db8::1]:56324"))), "[2001:db8::1]:56324", false},
+		{string(proxyV2Header(0x20, 0x00, netip.AddrPort{})), "", false}, // LOCAL
+		{string(proxyV2Header(0x11, 0x11, netip.MustParseAddrPort("192.0.2.1:56324"))), "", true},
+	}
+	for idx, tc := range tests {
+		r := bufio.NewReader(strings.NewReader(tc.header + "payload"))
+		src, err := readProxyHeader(r)
+		if tc.invalid {
+			if err == nil {
+				t.Fatalf("TestReadProxyHeader: Expected an error for header `%d`. Found `%s`.", idx, src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestReadProxyHeader: Unexpected error for header `%d`: %s", idx, err)
+		}
+		if (tc.expected == "" && src.IsValid()) || (tc.expected != "" && src.String() != tc.expected) {
+			t.Fatalf("TestReadProxyHeader: Unexpected source for header `%d`. Expected `%s`. Found `%s`.", idx, tc.expected, src)
+		}
+		// the data after the header is kept
+		if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+			t.Fatalf("TestReadProxyHeader: Unexpected data after header `%d`: `%s`.", idx, rest)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "127.0.0.0/8")); err != nil {
+		t.Fatalf("TestListener: %s", err)
+	}
+	l := NewListener(mustListen(t), ip)
+	defer l.Close()
+
+	accepted := acceptOne(l)
+	conn := mustDial(t, l.Addr())
+	defer conn.Close()
+	// the connection is closed by the listener and never accepted
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("TestListener: Expected the connection to be closed. Found `%v`.", err)
+	}
+	select {
+	case <-accepted:
+		t.Fatalf("TestListener: A denied connection was accepted.")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if l.Rejected() != 1 {
+		t.Fatalf("TestListener: Expected `1` rejected connection. Found `%d`.", l.Rejected())
+	}
+
+	// allowed connections are returned by Accept
+	ip.SetMode(ModeAllow)
+	conn2 := mustDial(t, l.Addr())
+	defer conn2.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestListener: An allowed connection was not accepted.")
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "203.0.113.0/24")); err != nil {
+		t.Fatalf("TestProxyProtocolListener: %s", err)
+	}
+	l := NewProxyProtocolListener(mustListen(t), ip, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	l.SetProxyHeaderTimeout(time.Second)
+	defer l.Close()
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// a slow client without a header doesn't block the other clients and is closed after the timeout
+	slow := mustDial(t, l.Addr())
+	defer slow.Close()
+
+	// a denied client behind the proxy is closed
+	denied := mustDial(t, l.Addr())
+	defer denied.Close()
+	denied.Write([]byte("PROXY TCP4 203.0.113.1 127.0.0.1 56324 443\r\n"))
+
+	// an allowed client is accepted with its address and the data after the header
+	allowed := mustDial(t, l.Addr())
+	defer allowed.Close()
+	allowed.Write(append(proxyV2Header(0x21, 0x11, netip.MustParseAddrPort("192.0.2.1:56324")), []byte("hello")...))
+
+	select {
+	case c := <-accepted:
+		defer c.Close()
+		if c.RemoteAddr().String() != "192.0.2.1:56324" {
+			t.Fatalf("TestProxyProtocolListener: Unexpected remote address `%s`.", c.RemoteAddr())
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("TestProxyProtocolListener: Unexpected data `%s` (%v).", buf, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestProxyProtocolListener: The allowed connection was not accepted.")
+	}
+
+	for _, c := range []net.Conn{denied, slow} {
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("TestProxyProtocolListener: Expected the connection to be closed. Found `%v`.", err)
+		}
+	}
+	if l.Rejected() != 2 {
+		t.Fatalf("TestProxyProtocolListener: Expected `2` rejected connections. Found `%d`.", l.Rejected())
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// proxyV2Header builds a PROXY protocol v2 header with a source address (the destination is the same address)
+func proxyV2Header(verCmd byte, family byte, src netip.AddrPort) []byte {
+	var payload []byte
+	switch family >> 4 {
+	case 0x1:
+		a := src.Addr().As4()
+		payload = append(append(payload, a[:]...), a[:]...)
+	case 0x2:
+		a := src.Addr().As16()
+		payload = append(append(payload, a[:]...), a[:]...)
+	}
+	if len(payload) > 0 {
+		payload = binary.BigEndian.AppendUint16(payload, src.Port())
+		payload = binary.BigEndian.AppendUint16(payload, 443)
+	}
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, verCmd, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func mustListen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func mustDial(t *testing.T, addr net.Addr) net.Conn {
+	c, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// acceptOne accepts a single connection in the background
+func acceptOne(l net.Listener) <-chan net.Conn {
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	return accepted
+}
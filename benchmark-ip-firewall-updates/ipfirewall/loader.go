@@ -0,0 +1,437 @@
+package ipfirewall
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/****************/
+/*    Format    */
+/****************/
+
+// Format is the format of a rules file
+type Format int
+
+const (
+	FormatText Format = iota // one CIDR per line, `#` starts a comment
+	FormatJSON
+	FormatYAML
+)
+
+const (
+	textStr = "text"
+	jsonStr = "json"
+	yamlStr = "yaml"
+)
+
+func (f Format) String() string {
+	return [...]string{textStr, jsonStr, yamlStr}[f]
+}
+
+// FormatFromPath guesses the format of a rules file from its extension. Unknown extensions are plain text.
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatText
+}
+
+/****************/
+/*    Errors    */
+/****************/
+
+// ParseError is returned for every invalid entry of a rules file
+type ParseError struct {
+	Name  string // name of the file
+	Line  int
+	Entry string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: invalid entry `%s`: %s", e.Name, e.Line, e.Entry, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+/****************/
+/*    Parsing   */
+/****************/
+
+// RulesFile is the content of a rules file
+type RulesFile struct {
+	Mode     *FWMode // nil if the file does not set the mode
+	Prefixes []netip.Prefix
+}
+
+// ParseRules parses the content of a rules file. Every entry is validated and all the invalid entries are returned
+// (as *ParseError joined with errors.Join), so a list can be fixed in one go.
+//
+// Text files contain one CIDR (or address, or range like `192.0.2.10-192.0.2.20`) per line. JSON and YAML files contain either a list of CIDRs or an object
+// with an optional `mode` (`allow`, `block` or `disabled`) and a list of `rules`.
+func ParseRules(data []byte, format Format, name string) (*RulesFile, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSONRules(data, name)
+	case FormatYAML:
+		return parseYAMLRules(data, name)
+	}
+	return parseTextRules(data, name)
+}
+
+// ruleParser collects the prefixes and the errors of a file
+type ruleParser struct {
+	name string
+	file *RulesFile
+	errs []error
+}
+
+func (p *ruleParser) addError(line int, entry string, err error) {
+	p.errs = append(p.errs, &ParseError{Name: p.name, Line: line, Entry: entry, Err: err})
+}
+
+func (p *ruleParser) addEntry(line int, entry string) {
+	if strings.Contains(entry, "-") {
+		prefixes, err := ParseRange(entry)
+		if err != nil {
+			p.addError(line, entry, err)
+			return
+		}
+		p.file.Prefixes = append(p.file.Prefixes, prefixes...)
+		return
+	}
+	prefix, err := parsePrefix(entry)
+	if err == nil {
+		var ok bool
+		if prefix, ok = canonicalPrefix(prefix); !ok {
+			err = ErrInvalidNetwork
+		}
+	}
+	if err != nil {
+		p.addError(line, entry, err)
+		return
+	}
+	p.file.Prefixes = append(p.file.Prefixes, prefix)
+}
+
+func (p *ruleParser) setMode(line int, entry string) {
+	m, err := ParseFWMode(entry)
+	if err != nil {
+		p.addError(line, entry, err)
+		return
+	}
+	p.file.Mode = &m
+}
+
+func (p *ruleParser) result() (*RulesFile, error) {
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	return p.file, nil
+}
+
+func parseTextRules(data []byte, name string) (*RulesFile, error) {
+	p := &ruleParser{name: name, file: &RulesFile{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		entry := scanner.Text()
+		if idx := strings.IndexByte(entry, '#'); idx >= 0 {
+			entry = entry[:idx]
+		}
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		p.addEntry(line, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p.result()
+}
+
+func parseJSONRules(data []byte, name string) (*RulesFile, error) {
+	p := &ruleParser{name: name, file: &RulesFile{}}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// the decoder offset is at the end of the last token, so the line of a (single line) token is known
+	lineOf := func() int {
+		return 1 + bytes.Count(data[:dec.InputOffset()], []byte{'\n'})
+	}
+	syntaxError := func(err error) (*RulesFile, error) {
+		return nil, &ParseError{Name: name, Line: lineOf(), Err: err}
+	}
+	// parseList reads the strings of a list (after the opening bracket)
+	parseList := func() error {
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			s, ok := tok.(string)
+			if !ok {
+				p.addError(lineOf(), fmt.Sprint(tok), errors.New("expected a string"))
+				continue
+			}
+			p.addEntry(lineOf(), s)
+		}
+		_, err := dec.Token() // closing bracket
+		return err
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return syntaxError(err)
+	}
+	switch tok {
+	case json.Delim('['):
+		if err := parseList(); err != nil {
+			return syntaxError(err)
+		}
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return syntaxError(err)
+			}
+			switch key {
+			case "mode":
+				val, err := dec.Token()
+				if err != nil {
+					return syntaxError(err)
+				}
+				p.setMode(lineOf(), fmt.Sprint(val))
+			case "rules":
+				if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+					return syntaxError(errors.New("`rules` must be a list"))
+				}
+				if err := parseList(); err != nil {
+					return syntaxError(err)
+				}
+			default:
+				return syntaxError(fmt.Errorf("unknown field `%v`", key))
+			}
+		}
+	default:
+		return syntaxError(errors.New("expected a list or an object"))
+	}
+	return p.result()
+}
+
+func parseYAMLRules(data []byte, name string) (*RulesFile, error) {
+	p := &ruleParser{name: name, file: &RulesFile{}}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, &ParseError{Name: name, Err: err}
+	}
+	if len(doc.Content) == 0 {
+		return p.result() // empty file
+	}
+	parseList := func(list *yaml.Node) error {
+		if list.Kind != yaml.SequenceNode {
+			return &ParseError{Name: name, Line: list.Line, Entry: list.Value, Err: errors.New("expected a list")}
+		}
+		for _, n := range list.Content {
+			if n.Kind != yaml.ScalarNode {
+				p.addError(n.Line, n.Value, errors.New("expected a string"))
+				continue
+			}
+			p.addEntry(n.Line, n.Value)
+		}
+		return nil
+	}
+
+	root := doc.Content[0]
+	switch root.Kind {
+	case yaml.SequenceNode:
+		if err := parseList(root); err != nil {
+			return nil, err
+		}
+	case yaml.MappingNode:
+		for idx := 0; idx+1 < len(root.Content); idx += 2 {
+			key, val := root.Content[idx], root.Content[idx+1]
+			switch key.Value {
+			case "mode":
+				p.setMode(val.Line, val.Value)
+			case "rules":
+				if err := parseList(val); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, &ParseError{Name: name, Line: key.Line, Entry: key.Value, Err: errors.New("unknown field")}
+			}
+		}
+	default:
+		return nil, &ParseError{Name: name, Line: root.Line, Entry: root.Value, Err: errors.New("expected a list or a mapping")}
+	}
+	return p.result()
+}
+
+/****************/
+/*    Loader    */
+/****************/
+
+// Loader loads the rules of a firewall from a file and reloads them when the file changes.
+// A Loader must only be used by a single goroutine (except Report).
+type Loader struct {
+	fw       *IPFirewall
+	path     string
+	format   Format
+	modTime  time.Time
+	size     int64
+	checksum [sha256.Size]byte
+	reportMu sync.Mutex
+	report   NormalizeReport // normalization report of the last loaded file
+
+	// Normalize merges the adjacent prefixes and removes the covered prefixes of the file before they are applied
+	// (see Normalize). It must be set before Load or Watch.
+	Normalize bool
+
+	// OnError is called by Watch when the file can't be reloaded (the firewall keeps the previous rules)
+	OnError func(error)
+	// OnReload is called by Watch after the rules are reloaded with the new version of the firewall
+	OnReload func(version uint64)
+}
+
+// NewLoader creates a loader for a file. The format is guessed from the extension of the file.
+func NewLoader(fw *IPFirewall, path string) *Loader {
+	return NewLoaderWithFormat(fw, path, FormatFromPath(path))
+}
+
+// NewLoaderWithFormat creates a loader for a file with a given format
+func NewLoaderWithFormat(fw *IPFirewall, path string, format Format) *Loader {
+	return &Loader{
+		fw:     fw,
+		path:   path,
+		format: format,
+	}
+}
+
+// Load reads the file and replaces the rules that follow the mode (and the mode, if the file sets it) of the firewall
+// with a single update. The explicit allow and deny rules and the temporary rules are kept: they are owned by the API,
+// and a prefix of the file that is an explicit rule keeps its action. If any entry is invalid the firewall is not updated.
+func (l *Loader) Load() error {
+	fileStat, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	return l.apply(fileStat, data)
+}
+
+// Report returns the normalization report of the last loaded file (if Normalize is set).
+// It can be called from any goroutine, also while watching.
+func (l *Loader) Report() NormalizeReport {
+	l.reportMu.Lock()
+	defer l.reportMu.Unlock()
+	return l.report
+}
+
+// Watch polls the file at every interval and reloads the rules when its content changes, until the context is done.
+// Reload errors are reported to OnError and do not stop the watcher.
+func (l *Loader) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		reloaded, err := l.reload()
+		if err != nil {
+			if l.OnError != nil {
+				l.OnError(err)
+			}
+			continue
+		}
+		if reloaded && l.OnReload != nil {
+			l.OnReload(l.fw.ReadVersion())
+		}
+	}
+}
+
+// reload loads the file only if its size, modification time and content have changed
+func (l *Loader) reload() (bool, error) {
+	fileStat, err := os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+	if fileStat.ModTime().Equal(l.modTime) && fileStat.Size() == l.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return false, err
+	}
+	if sha256.Sum256(data) == l.checksum {
+		// only the metadata has changed (e.g. touch)
+		l.modTime, l.size = fileStat.ModTime(), fileStat.Size()
+		return false, nil
+	}
+	if err := l.apply(fileStat, data); err != nil {
+		// don't report the same broken file at every tick, it is retried once it changes again
+		l.modTime, l.size = fileStat.ModTime(), fileStat.Size()
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *Loader) apply(fileStat os.FileInfo, data []byte) error {
+	f, err := ParseRules(data, l.format, l.path)
+	if err != nil {
+		return err
+	}
+	var report NormalizeReport
+	if err := l.fw.Update(func(rs *RuleSet) error {
+		// the file owns the permanent rules that follow the mode: the explicit allow and deny rules and the temporary
+		// rules (e.g. added during an incident) are added through the API and are kept
+		rs.ResetModeRules()
+		if f.Mode != nil {
+			if err := rs.SetMode(*f.Mode); err != nil {
+				return err
+			}
+		}
+		prefixes := f.Prefixes
+		if l.Normalize {
+			prefixes, report = Normalize(prefixes)
+		}
+		for _, p := range prefixes {
+			if rs.isAPIRule(p) {
+				continue // the action and the expiry of the explicit and temporary rules are not replaced by the file
+			}
+			if err := rs.Add(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	l.modTime, l.size, l.checksum = fileStat.ModTime(), fileStat.Size(), sha256.Sum256(data)
+	l.reportMu.Lock()
+	l.report = report
+	l.reportMu.Unlock()
+	return nil
+}
@@ -0,0 +1,201 @@
+package ipfirewall
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+		mode   *FWMode
+	}{
+		{FormatText, "# blocklist\n10.0.0.0/8\n\n192.0.2.1 # single address\n  2001:db8::/32  \n", nil},
+		{FormatJSON, `["10.0.0.0/8", "192.0.2.1", "2001:db8::/32"]`, nil},
+		{FormatJSON, "{\n\"mode\": \"block\",\n\"rules\": [\"10.0.0.0/8\", \"192.0.2.1\", \"2001:db8::/32\"]\n}", modePtr(ModeBlock)},
+		{FormatYAML, "- 10.0.0.0/8\n- 192.0.2.1\n- 2001:db8::/32\n", nil},
+		{FormatYAML, "mode: allow\nrules:\n  - 10.0.0.0/8\n  - 192.0.2.1 # comment\n  - 2001:db8::/32\n", modePtr(ModeAllow)},
+	}
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32"}
+
+	for _, tc := range tests {
+		f, err := ParseRules([]byte(tc.data), tc.format, "rules")
+		if err != nil {
+			t.Fatalf("TestParseRules: Unexpected error for format `%s`: %s", tc.format, err)
+		}
+		if len(f.Prefixes) != len(expected) {
+			t.Fatalf("TestParseRules: Unexpected prefixes for format `%s`. Found `%v`.", tc.format, f.Prefixes)
+		}
+		for idx, p := range f.Prefixes {
+			if p.String() != expected[idx] {
+				t.Fatalf("TestParseRules: Unexpected prefix for format `%s`. Expected `%s`. Found `%s`.", tc.format, expected[idx], p)
+			}
+		}
+		if (tc.mode == nil) != (f.Mode == nil) || (tc.mode != nil && *tc.mode != *f.Mode) {
+			t.Fatalf("TestParseRules: Unexpected mode for format `%s`.", tc.format)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+		lines  []int
+	}{
+		{FormatText, "10.0.0.0/8\n10.0.0.0/33\n# comment\nnot-an-ip\n", []int{2, 4}},
+		{FormatJSON, "{\n\"mode\": \"block\",\n\"rules\": [\n\"10.0.0.0/8\",\n\"300.0.0.0/8\",\n42\n]\n}", []int{5, 6}},
+		{FormatYAML, "mode: sometimes\nrules:\n  - 10.0.0.0/8\n  - fe80::1%eth0\n", []int{1, 4}},
+	}
+	for _, tc := range tests {
+		_, err := ParseRules([]byte(tc.data), tc.format, "rules")
+		if err == nil {
+			t.Fatalf("TestParseRulesErrors: Expected errors for format `%s`.", tc.format)
+		}
+		// every invalid entry is reported with its line number
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok || len(joined.Unwrap()) != len(tc.lines) {
+			t.Fatalf("TestParseRulesErrors: Expected `%d` errors for format `%s`. Found `%v`.", len(tc.lines), tc.format, err)
+		}
+		for idx, e := range joined.Unwrap() {
+			var pe *ParseError
+			if !errors.As(e, &pe) || pe.Line != tc.lines[idx] {
+				t.Fatalf("TestParseRulesErrors: Expected an error on line `%d` for format `%s`. Found `%v`.", tc.lines[idx], tc.format, e)
+			}
+		}
+	}
+}
+
+func TestLoaderLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.yaml")
+	writeRulesFile(t, path, "mode: block\nrules:\n  - 10.0.0.0/8\n")
+
+	ip := NewIPFirewall()
+	if err := NewLoader(ip, path).Load(); err != nil {
+		t.Fatalf("TestLoaderLoad: %s", err)
+	}
+	if ip.Mode() != ModeBlock || ip.Decide(netip.MustParseAddr("10.1.1.1")) != VerdictDeny {
+		t.Fatalf("TestLoaderLoad: The rules were not loaded. Found mode `%s` and rules `%v`.", ip.Mode(), ip.IPList())
+	}
+
+	// a broken file does not change the firewall
+	writeRulesFile(t, path, "rules:\n  - 10.0.0.0/8\n  - 10.0.0.0/99\n")
+	if err := NewLoader(ip, path).Load(); err == nil {
+		t.Fatalf("TestLoaderLoad: Expected an error for an invalid file.")
+	}
+	if ip.ReadVersion() != 1 {
+		t.Fatalf("TestLoaderLoad: The firewall was updated with an invalid file. Found version `%d`.", ip.ReadVersion())
+	}
+}
+
+// TestLoaderKeepsExplicitRules checks that the explicit rules added through the API survive the reloads of the file
+func TestLoaderKeepsExplicitRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	writeRulesFile(t, path, "10.0.0.0/8\n192.0.2.0/24\n")
+
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.Update(func(rs *RuleSet) error {
+		if err := rs.AddDeny(netip.MustParsePrefix("10.66.0.0/16")); err != nil {
+			return err
+		}
+		return rs.AddDeny(netip.MustParsePrefix("192.0.2.0/24"))
+	}); err != nil {
+		t.Fatalf("TestLoaderKeepsExplicitRules: %s", err)
+	}
+	l := NewLoader(ip, path)
+	for _, content := range []string{"10.0.0.0/8\n192.0.2.0/24\n", "10.0.0.0/8\n"} {
+		writeRulesFile(t, path, content)
+		if err := l.Load(); err != nil {
+			t.Fatalf("TestLoaderKeepsExplicitRules: %s", err)
+		}
+		// the explicit deny rules are kept, also for a prefix of the file
+		for addr, expected := range map[string]Verdict{"10.1.1.1": VerdictAllow, "10.66.1.1": VerdictDeny, "192.0.2.1": VerdictDeny} {
+			if v := ip.Decide(netip.MustParseAddr(addr)); v != expected {
+				t.Fatalf("TestLoaderKeepsExplicitRules: `%s`: Expected `%s`. Found `%s`.", addr, expected, v)
+			}
+		}
+	}
+}
+
+func TestLoaderWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRulesFile(t, path, "10.0.0.0/8\n")
+
+	ip := NewIPFirewallWithMode(ModeBlock)
+	l := NewLoader(ip, path)
+	l.Normalize = true
+	if err := l.Load(); err != nil {
+		t.Fatalf("TestLoaderWatch: %s", err)
+	}
+
+	reloads := make(chan uint64, 10)
+	errs := make(chan error, 10)
+	l.OnReload = func(version uint64) { reloads <- version }
+	l.OnError = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Watch(ctx, 5*time.Millisecond)
+
+	// the new file is applied without a restart
+	writeRulesFile(t, path, "10.0.0.0/8\n192.0.2.0/24\n")
+	select {
+	case v := <-reloads:
+		if v != 2 || ip.Decide(netip.MustParseAddr("192.0.2.1")) != VerdictDeny {
+			t.Fatalf("TestLoaderWatch: Unexpected firewall after reload. Version `%d`. Rules `%v`.", v, ip.IPList())
+		}
+		if report := l.Report(); report.Input != 2 {
+			t.Fatalf("TestLoaderWatch: Unexpected report after reload `%+v`.", report)
+		}
+	case err := <-errs:
+		t.Fatalf("TestLoaderWatch: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestLoaderWatch: The file was not reloaded.")
+	}
+
+	// a broken file is reported and the previous rules are kept
+	writeRulesFile(t, path, "10.0.0.0/8\nbroken\n")
+	select {
+	case err := <-errs:
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Line != 2 {
+			t.Fatalf("TestLoaderWatch: Unexpected error `%v`.", err)
+		}
+	case <-reloads:
+		t.Fatalf("TestLoaderWatch: A broken file was applied.")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestLoaderWatch: The broken file was not reported.")
+	}
+	if ip.ReadVersion() != 2 {
+		t.Fatalf("TestLoaderWatch: The firewall was updated with a broken file. Found version `%d`.", ip.ReadVersion())
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+func modePtr(m FWMode) *FWMode {
+	return &m
+}
+
+// writeRulesFile writes a file with a new modification time (so that coarse filesystem timestamps see the change)
+func writeRulesFile(t *testing.T, path string, data string) {
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	next := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(path, next, next); err != nil {
+		t.Fatal(err)
+	}
+}
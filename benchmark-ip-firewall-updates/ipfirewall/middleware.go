@@ -0,0 +1,55 @@
+package ipfirewall
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+/****************/
+/*  Middleware  */
+/****************/
+
+// Middleware is a net/http middleware that consults the firewall for every request
+type Middleware struct {
+	fw       *IPFirewall
+	clientIP ClientIPFunc
+	rejected *shardedCounter
+}
+
+// NewMiddleware creates a middleware that uses the remote address of the requests
+func NewMiddleware(fw *IPFirewall) *Middleware {
+	return NewMiddlewareWithClientIP(fw, RemoteAddrIP)
+}
+
+// NewMiddlewareWithClientIP creates a middleware with a function to extract the address of the client
+// (e.g. ForwardedForIP behind a load balancer)
+func NewMiddlewareWithClientIP(fw *IPFirewall, clientIP ClientIPFunc) *Middleware {
+	return &Middleware{
+		fw:       fw,
+		clientIP: clientIP,
+		rejected: newShardedCounter(),
+	}
+}
+
+// Handler wraps a handler. Denied requests get a `403 Forbidden` response and never reach the wrapped handler.
+// A request without a valid client address is decided like any address that is not in the list
+// (denied by an allowlist and allowed by a blocklist).
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := m.clientIP(r)
+		if err != nil {
+			addr = netip.Addr{}
+		}
+		if m.fw.Decide(addr) == VerdictDeny {
+			m.rejected.Inc()
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejected returns the number of requests rejected by the middleware
+func (m *Middleware) Rejected() uint64 {
+	return m.rejected.Load()
+}
@@ -0,0 +1,105 @@
+package ipfirewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestForwardedForIP(t *testing.T) {
+	clientIP := ForwardedForIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	tests := []struct {
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"}, // untrusted peers can't spoof the header
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.7, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"}, // the leftmost hop can be spoofed
+		{"10.0.0.1:1234", []string{"203.0.113.7", "198.51.100.1,10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"[::ffff:10.0.0.1]:1234", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, h := range tc.xff {
+			r.Header.Add("X-Forwarded-For", h)
+		}
+		addr, err := clientIP(r)
+		if err != nil || addr.String() != tc.expected {
+			t.Fatalf("TestForwardedForIP: Unexpected client for `%s` and `%v`. Expected `%s`. Found `%s` (%v).", tc.remoteAddr, tc.xff, tc.expected, addr, err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "not-an-ip")
+	if _, err := clientIP(r); err != ErrInvalidClientIP {
+		t.Fatalf("TestForwardedForIP: Expected `%v`. Found `%v`.", ErrInvalidClientIP, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(t, "203.0.113.0/24")); err != nil {
+		t.Fatalf("TestMiddleware: %s", err)
+	}
+	m := NewMiddlewareWithClientIP(ip, ForwardedForIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		expected   int
+	}{
+		{"192.0.2.1:1234", "", http.StatusNoContent},
+		{"203.0.113.1:1234", "", http.StatusForbidden},
+		{"10.0.0.1:1234", "203.0.113.1", http.StatusForbidden},
+		{"10.0.0.1:1234", "192.0.2.1", http.StatusNoContent},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.expected {
+			t.Fatalf("TestMiddleware: Unexpected status for `%s` and `%s`. Expected `%d`. Found `%d`.", tc.remoteAddr, tc.xff, tc.expected, w.Code)
+		}
+	}
+	if m.Rejected() != 2 {
+		t.Fatalf("TestMiddleware: Expected `2` rejected requests. Found `%d`.", m.Rejected())
+	}
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+func BenchmarkMiddleware(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.SetIPList(mustParseIPList(b, "203.0.113.0/24")); err != nil {
+		b.Fatal(err)
+	}
+	handler := NewMiddleware(ip).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,256 @@
+package ipfirewall
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+/****************/
+/*    Ranges    */
+/****************/
+
+// ErrInvalidRange is returned for an IP range with addresses of different families or a start after its end
+var ErrInvalidRange = errors.New("ipfirewall: invalid ip range")
+
+// RangeToPrefixes returns the minimal list of prefixes covering exactly the addresses from start to end (included)
+func RangeToPrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	if !start.IsValid() || !end.IsValid() || start.Zone() != "" || end.Zone() != "" {
+		return nil, ErrInvalidRange
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.BitLen() != end.BitLen() || start.Compare(end) > 0 {
+		return nil, ErrInvalidRange
+	}
+	return rangeToPrefixes(start, end), nil
+}
+
+// ParseRange parses an IP range like `192.0.2.10-192.0.2.20` and returns its minimal list of prefixes
+func ParseRange(s string) ([]netip.Prefix, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, ErrInvalidRange
+	}
+	start, err := netip.ParseAddr(strings.TrimSpace(first))
+	if err != nil {
+		return nil, ErrInvalidRange
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil {
+		return nil, ErrInvalidRange
+	}
+	return RangeToPrefixes(start, end)
+}
+
+// rangeToPrefixes splits a valid range into the largest aligned blocks, from the start to the end
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// the shortest prefix starting at `start` that does not go past `end` (a /32 or /128 always fits)
+		var p netip.Prefix
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			p = netip.PrefixFrom(start, bits)
+			if p.Masked().Addr() == start && lastAddr(p).Compare(end) <= 0 {
+				break
+			}
+		}
+		prefixes = append(prefixes, p)
+		last := lastAddr(p)
+		if last == end {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+/****************/
+/*   Normalize  */
+/****************/
+
+// NormalizeReport is the result of the normalization of a list of prefixes
+type NormalizeReport struct {
+	Input      int // number of prefixes before the normalization
+	Output     int // number of prefixes after the normalization
+	Invalid    int // invalid prefixes (dropped)
+	Duplicates int // prefixes present more than once (after masking)
+	Covered    int // prefixes covered by a broader prefix
+	Merged     int // prefixes saved by merging adjacent prefixes
+}
+
+// Saved returns the number of prefixes removed by the normalization
+func (r NormalizeReport) Saved() int {
+	return r.Input - r.Output
+}
+
+// Normalize returns the minimal sorted list of prefixes covering the same addresses: the prefixes are masked,
+// the duplicates and the prefixes covered by a broader prefix are removed and the adjacent prefixes are merged
+// (e.g. `10.0.0.0/25` and `10.0.0.128/25` become `10.0.0.0/24`). Invalid prefixes are dropped.
+func Normalize(prefixes []netip.Prefix) ([]netip.Prefix, NormalizeReport) {
+	report := NormalizeReport{Input: len(prefixes)}
+
+	unique := make([]netip.Prefix, 0, len(prefixes))
+	seen := make(map[netip.Prefix]bool, len(prefixes))
+	for _, p := range prefixes {
+		p, ok := canonicalPrefix(p)
+		switch {
+		case !ok:
+			report.Invalid++
+		case seen[p]:
+			report.Duplicates++
+		default:
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	// the remaining prefixes are disjoint
+	tree := newIPTree(unique)
+	disjoint := make([]netip.Prefix, 0, len(unique))
+	for _, p := range unique {
+		if tree.lookupCovering(p, p.Bits()-1) != noRule {
+			report.Covered++
+			continue
+		}
+		disjoint = append(disjoint, p)
+	}
+	sortPrefixes(disjoint)
+
+	// adjacent prefixes are joined into ranges and each range is split into its minimal list of prefixes
+	var normalized []netip.Prefix
+	for idx := 0; idx < len(disjoint); {
+		start, end := disjoint[idx].Addr(), lastAddr(disjoint[idx])
+		for idx++; idx < len(disjoint); idx++ {
+			next := end.Next()
+			if !next.IsValid() || disjoint[idx].Addr() != next {
+				break
+			}
+			end = lastAddr(disjoint[idx])
+		}
+		normalized = append(normalized, rangeToPrefixes(start, end)...)
+	}
+	report.Output = len(normalized)
+	report.Merged = len(disjoint) - len(normalized)
+	return normalized, report
+}
+
+// Normalize normalizes the permanent rules of the rule set without changing any verdict: a rule is removed if the
+// nearest broader rule is a permanent rule with the same action, and two adjacent rules with the same action are
+// merged if their parent prefix is not a rule (explicit allow and deny rules stay in place). Temporary rules are
+// kept as they are.
+func (rs *RuleSet) Normalize() NormalizeReport {
+	report := NormalizeReport{Input: rs.permanentLen()}
+	for {
+		covered := rs.removeCovered()
+		merged := rs.mergeSiblings()
+		report.Covered += covered
+		report.Merged += merged
+		if covered == 0 && merged == 0 {
+			break
+		}
+	}
+	report.Output = rs.permanentLen()
+	return report
+}
+
+// removeCovered removes the permanent rules that don't change any verdict and returns the number of removed rules
+func (rs *RuleSet) removeCovered() int {
+	rules := rs.Rules()
+	prefixes := make([]netip.Prefix, len(rules))
+	for idx, r := range rules {
+		prefixes[idx] = r.Prefix
+	}
+	tree := newIPTree(prefixes)
+
+	removed := 0
+	for _, r := range rules {
+		if r.IsTemporary() {
+			continue
+		}
+		parent := tree.lookupCovering(r.Prefix, r.Prefix.Bits()-1)
+		if parent != noRule && !rules[parent].IsTemporary() && rules[parent].Action == r.Action {
+			delete(rs.rules, r.Prefix)
+			removed++
+		}
+	}
+	return removed
+}
+
+// mergeSiblings replaces two permanent sibling rules with the same action by their parent prefix
+// and returns the number of merges
+func (rs *RuleSet) mergeSiblings() int {
+	pending := make([]netip.Prefix, 0, len(rs.rules))
+	for p := range rs.rules {
+		pending = append(pending, p)
+	}
+
+	merged := 0
+	for len(pending) > 0 {
+		p := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		r, ok := rs.rules[p]
+		if !ok || r.IsTemporary() || p.Bits() == 0 {
+			continue
+		}
+		parent := netip.PrefixFrom(p.Addr(), p.Bits()-1).Masked()
+		sibling := netip.PrefixFrom(parent.Addr(), p.Bits())
+		if sibling == p {
+			sibling = netip.PrefixFrom(lastAddr(parent), p.Bits()).Masked()
+		}
+		s, ok := rs.rules[sibling]
+		if !ok || s.IsTemporary() || s.Action != r.Action {
+			continue
+		}
+		if _, ok := rs.rules[parent]; ok {
+			continue
+		}
+		delete(rs.rules, p)
+		delete(rs.rules, sibling)
+		rs.AddAction(parent, r.Action) // the parent is valid
+		pending = append(pending, parent)
+		merged++
+	}
+	return merged
+}
+
+// permanentLen returns the number of permanent rules
+func (rs *RuleSet) permanentLen() int {
+	n := 0
+	for _, r := range rs.rules {
+		if !r.IsTemporary() {
+			n++
+		}
+	}
+	return n
+}
+
+// Normalize normalizes the permanent rules of the firewall (see RuleSet.Normalize) and increments the version.
+// The hits of the rules that are removed or merged are dropped.
+func (i *IPFirewall) Normalize() (NormalizeReport, error) {
+	var report NormalizeReport
+	err := i.Update(func(rs *RuleSet) error {
+		report = rs.Normalize()
+		return nil
+	})
+	return report, err
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// lastAddr returns the last address of a prefix (i.e. with all the host bits set)
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().As16()
+	offset := 0
+	if p.Addr().Is4() {
+		offset = 96
+	}
+	for bit := offset + p.Bits(); bit < 128; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr := netip.AddrFrom16(b)
+	if p.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
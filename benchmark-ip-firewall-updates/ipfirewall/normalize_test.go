@@ -0,0 +1,178 @@
+package ipfirewall
+
+import (
+	"math/rand"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestRangeToPrefixes(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"192.0.2.0-192.0.2.255", "[192.0.2.0/24]"},
+		{"192.0.2.10-192.0.2.20", "[192.0.2.10/31 192.0.2.12/30 192.0.2.16/30 192.0.2.20/32]"},
+		{"10.0.0.1 - 10.0.0.1", "[10.0.0.1/32]"},
+		{"0.0.0.0-255.255.255.255", "[0.0.0.0/0]"},
+		{"255.255.255.254-255.255.255.255", "[255.255.255.254/31]"},
+		{"::ffff:10.0.0.0-10.0.0.3", "[10.0.0.0/30]"},
+		{"2001:db8::-2001:db8::ffff", "[2001:db8::/112]"},
+		{"2001:db8::1-2001:db8::2", "[2001:db8::1/128 2001:db8::2/128]"},
+		{"::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "[::/0]"},
+	}
+	for _, tc := range tests {
+		prefixes, err := ParseRange(tc.in)
+		if err != nil {
+			t.Fatalf("TestRangeToPrefixes: Unexpected error for `%s`: %s", tc.in, err)
+		}
+		if found := prefixList(prefixes).String(); found != tc.expected {
+			t.Fatalf("TestRangeToPrefixes: Unexpected prefixes for `%s`. Expected `%s`. Found `%s`.", tc.in, tc.expected, found)
+		}
+	}
+
+	for _, in := range []string{"192.0.2.20-192.0.2.10", "10.0.0.1-2001:db8::1", "10.0.0.1", "10.0.0.1-x", "fe80::1%eth0-fe80::2"} {
+		if _, err := ParseRange(in); err != ErrInvalidRange {
+			t.Fatalf("TestRangeToPrefixes: Expected `%v` for `%s`. Found `%v`.", ErrInvalidRange, in, err)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	in := mustParsePrefixes(t,
+		"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32", // covered
+		"192.0.2.0/25", "192.0.2.128/26", "192.0.2.192/26", // adjacent
+		"192.0.2.0/25",                       // duplicate
+		"198.51.100.0/24", "198.51.101.0/24", // adjacent but not aligned on a /23
+		"203.0.113.7/32",
+		"2001:db8::/33", "2001:db8:8000::/33", // adjacent
+	)
+	in = append(in, netip.Prefix{})
+	normalized, report := Normalize(in)
+
+	expected := "[10.0.0.0/8 192.0.2.0/24 198.51.100.0/23 203.0.113.7/32 2001:db8::/32]"
+	if found := prefixList(normalized).String(); found != expected {
+		t.Fatalf("TestNormalize: Expected `%s`. Found `%s`.", expected, found)
+	}
+	expectedReport := NormalizeReport{Input: 13, Output: 5, Invalid: 1, Duplicates: 1, Covered: 2, Merged: 4}
+	if report != expectedReport || report.Saved() != 8 {
+		t.Fatalf("TestNormalize: Expected `%+v`. Found `%+v`.", expectedReport, report)
+	}
+}
+
+// TestNormalizeRandom checks that the normalized prefixes match exactly the same addresses
+func TestNormalizeRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rnd, 2000)
+	normalized, report := Normalize(prefixes)
+	if report.Output >= report.Input {
+		t.Fatalf("TestNormalizeRandom: Expected fewer prefixes. Found `%+v`.", report)
+	}
+
+	tree, normalizedTree := newIPTree(prefixes), newIPTree(normalized)
+	for n := 0; n < 20000; n++ {
+		addr := randomAddr(rnd)
+		if (tree.lookup(addr) == noRule) != (normalizedTree.lookup(addr) == noRule) {
+			t.Fatalf("TestNormalizeRandom: The normalized prefixes do not match `%s` like the original prefixes.", addr)
+		}
+	}
+	// normalizing twice changes nothing
+	if again, _ := Normalize(normalized); prefixList(again).String() != prefixList(normalized).String() {
+		t.Fatalf("TestNormalizeRandom: The normalization is not idempotent.")
+	}
+}
+
+func TestRuleSetNormalize(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.Update(func(rs *RuleSet) error {
+		if err := rs.AddRange(netip.MustParseAddr("10.0.0.0"), netip.MustParseAddr("10.0.1.255")); err != nil {
+			return err
+		}
+		if err := rs.AddCIDR("10.0.0.128/25"); err != nil {
+			return err
+		}
+		return rs.AddUntil(netip.MustParsePrefix("10.0.0.7/32"), ActionDeny, time.Now().Add(time.Hour))
+	}); err != nil {
+		t.Fatalf("TestRuleSetNormalize: %s", err)
+	}
+
+	report, err := ip.Normalize()
+	if err != nil {
+		t.Fatalf("TestRuleSetNormalize: %s", err)
+	}
+	if report.Input != 2 || report.Output != 1 {
+		t.Fatalf("TestRuleSetNormalize: Unexpected report `%+v`.", report)
+	}
+	// the temporary rule is kept
+	if rules := ip.IPList(); len(rules) != 2 || rules[0].String() != "10.0.0.0/23" || rules[1].String() != "10.0.0.7/32" {
+		t.Fatalf("TestRuleSetNormalize: Unexpected rules `%v`.", rules)
+	}
+	if ip.ReadVersion() != 2 {
+		t.Fatalf("TestRuleSetNormalize: Expected version `2`. Found `%d`.", ip.ReadVersion())
+	}
+}
+
+func TestLoaderNormalize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRulesFile(t, path, "10.0.0.0/25\n10.0.0.128/25\n10.0.0.1\n192.0.2.0-192.0.2.127\n")
+
+	ip := NewIPFirewallWithMode(ModeBlock)
+	l := NewLoader(ip, path)
+	l.Normalize = true
+	if err := l.Load(); err != nil {
+		t.Fatalf("TestLoaderNormalize: %s", err)
+	}
+	expected := "[10.0.0.0/24 192.0.2.0/25]"
+	if found := prefixList(ip.Snapshot().Prefixes()).String(); found != expected {
+		t.Fatalf("TestLoaderNormalize: Expected `%s`. Found `%s`.", expected, found)
+	}
+	if report := l.Report(); report.Input != 4 || report.Output != 2 {
+		t.Fatalf("TestLoaderNormalize: Unexpected report `%+v`.", report)
+	}
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+func BenchmarkNormalize(b *testing.B) {
+	prefixes := randomPrefixes(rand.New(rand.NewSource(1)), 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Normalize(prefixes)
+	}
+}
+
+// BenchmarkIPTreeLookupNormalized runs the lookups of BenchmarkIPTreeLookup on the raw and the normalized prefixes
+func BenchmarkIPTreeLookupNormalized(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rnd, 10000)
+	normalized, _ := Normalize(prefixes)
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rnd)
+	}
+
+	for _, bc := range []struct {
+		name     string
+		prefixes []netip.Prefix
+	}{
+		{"raw", prefixes},
+		{"normalized", normalized},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			tree := newIPTree(bc.prefixes)
+			b.ReportMetric(float64(len(bc.prefixes)), "prefixes")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.lookup(addrs[i%len(addrs)])
+			}
+		})
+	}
+}
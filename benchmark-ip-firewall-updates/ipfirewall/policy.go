@@ -0,0 +1,101 @@
+package ipfirewall
+
+import (
+	"net/netip"
+	"time"
+)
+
+/****************/
+/*    Action    */
+/****************/
+
+// Action is the action of a rule. Rules added with Add follow the mode of the firewall (allowed by an allowlist and
+// denied by a blocklist), explicit rules always allow or deny their addresses. This gives layered policies like
+// "allow 10.0.0.0/8 except 10.66.0.0/16": an allowlist with 10.0.0.0/8 and an explicit deny rule for 10.66.0.0/16.
+type Action int
+
+const (
+	ActionMode  Action = iota // the rule follows the mode of the firewall
+	ActionAllow               // the rule always allows
+	ActionDeny                // the rule always denies
+)
+
+const (
+	actionModeStr  = "mode"
+	actionAllowStr = "allow"
+	actionDenyStr  = "deny"
+)
+
+func (a Action) String() string {
+	return [...]string{actionModeStr, actionAllowStr, actionDenyStr}[a]
+}
+
+// AddAction adds a permanent prefix with an action to the rule set. There is a single rule per prefix,
+// so adding a prefix that is already present replaces its action (and makes it permanent).
+func (rs *RuleSet) AddAction(p netip.Prefix, a Action) error {
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return ErrInvalidNetwork
+	}
+	r, ok := rs.rules[p]
+	if !ok {
+		r = Rule{Prefix: p, counters: rs.counters[p]}
+	}
+	r.Expires = time.Time{}
+	r.Action = a
+	rs.rules[p] = r
+	return nil
+}
+
+// AddAllow adds a permanent prefix that is always allowed (even by a blocklist)
+func (rs *RuleSet) AddAllow(p netip.Prefix) error {
+	return rs.AddAction(p, ActionAllow)
+}
+
+// AddDeny adds a permanent prefix that is always denied (even by an allowlist)
+func (rs *RuleSet) AddDeny(p netip.Prefix) error {
+	return rs.AddAction(p, ActionDeny)
+}
+
+/****************/
+/*   Decision   */
+/****************/
+
+// Decision is a verdict with the rule that produced it, for auditing
+type Decision struct {
+	Verdict Verdict
+	Rule    Rule // most specific rule containing the address (the zero value if Matched is false)
+	Matched bool // false if the verdict is the default action of the mode
+}
+
+// Explain returns the verdict of the snapshot for an address with the rule that produced it (see Decide).
+// The most specific rule containing the address wins, whatever its action. Addresses without a rule get the default
+// action of the mode: denied by an allowlist and allowed by a blocklist. A disabled firewall allows everything.
+func (s *Snapshot) Explain(addr netip.Addr) Decision {
+	if s.mode == ModeDisabled {
+		return Decision{Verdict: VerdictAllow}
+	}
+	rule := s.tree.lookup(addr)
+	if rule == noRule {
+		return Decision{Verdict: s.verdict(rule)}
+	}
+	return Decision{Verdict: s.verdict(rule), Rule: s.rules[rule], Matched: true}
+}
+
+// DefaultVerdict returns the verdict for the addresses that don't match any rule
+func (s *Snapshot) DefaultVerdict() Verdict {
+	return s.verdict(noRule)
+}
+
+// DecideRule returns the verdict of the firewall with the rule that produced it (see Snapshot.Explain).
+// The decision is counted like a decision of Decide.
+func (i *IPFirewall) DecideRule(addr netip.Addr) Decision {
+	s, rule, v := i.decide(addr)
+	if d := i.dryRun.Load(); d != nil {
+		d.evaluate(addr, v)
+	}
+	if rule == noRule {
+		return Decision{Verdict: v}
+	}
+	return Decision{Verdict: v, Rule: s.rules[rule], Matched: true}
+}
@@ -0,0 +1,149 @@
+package ipfirewall
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestLayeredPolicy(t *testing.T) {
+	// allow 10.0.0.0/8 except 10.66.0.0/16, but allow the monitoring hosts of 10.66.1.0/24
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.Update(func(rs *RuleSet) error {
+		if err := rs.AddCIDR("10.0.0.0/8"); err != nil {
+			return err
+		}
+		if err := rs.AddDeny(netip.MustParsePrefix("10.66.0.0/16")); err != nil {
+			return err
+		}
+		if err := rs.AddAllow(netip.MustParsePrefix("10.66.1.0/24")); err != nil {
+			return err
+		}
+		return rs.AddDeny(netip.MustParsePrefix("2001:db8::/32"))
+	}); err != nil {
+		t.Fatalf("TestLayeredPolicy: %s", err)
+	}
+
+	tests := []struct {
+		mode    FWMode
+		addr    string
+		verdict Verdict
+		rule    string // empty for the default action
+	}{
+		{ModeAllow, "10.1.1.1", VerdictAllow, "10.0.0.0/8"},
+		{ModeAllow, "10.66.2.1", VerdictDeny, "10.66.0.0/16"},
+		{ModeAllow, "10.66.1.1", VerdictAllow, "10.66.1.0/24"},
+		{ModeAllow, "192.0.2.1", VerdictDeny, ""},
+		{ModeAllow, "2001:db8::1", VerdictDeny, "2001:db8::/32"},
+		// the explicit rules keep their action in a blocklist, the other rules and the default action follow the mode
+		{ModeBlock, "10.1.1.1", VerdictDeny, "10.0.0.0/8"},
+		{ModeBlock, "10.66.2.1", VerdictDeny, "10.66.0.0/16"},
+		{ModeBlock, "10.66.1.1", VerdictAllow, "10.66.1.0/24"},
+		{ModeBlock, "192.0.2.1", VerdictAllow, ""},
+		// a disabled firewall ignores every rule
+		{ModeDisabled, "10.66.2.1", VerdictAllow, ""},
+	}
+	for _, tc := range tests {
+		ip.SetMode(tc.mode)
+		addr := netip.MustParseAddr(tc.addr)
+		d := ip.DecideRule(addr)
+		if d.Verdict != tc.verdict || d.Matched != (tc.rule != "") || (d.Matched && d.Rule.String() != tc.rule) {
+			t.Fatalf("TestLayeredPolicy: Unexpected decision for `%s` in mode `%s`. Expected `%s` by `%s`. Found `%+v`.", tc.addr, tc.mode, tc.verdict, tc.rule, d)
+		}
+		if v := ip.Decide(addr); v != tc.verdict {
+			t.Fatalf("TestLayeredPolicy: Unexpected verdict for `%s` in mode `%s`. Expected `%s`. Found `%s`.", tc.addr, tc.mode, tc.verdict, v)
+		}
+		if e := ip.Snapshot().Explain(addr); e != d {
+			t.Fatalf("TestLayeredPolicy: Explain differs from DecideRule for `%s`. Expected `%+v`. Found `%+v`.", tc.addr, d, e)
+		}
+	}
+
+	// a prefix has a single rule, so adding it again replaces its action
+	if err := ip.Update(func(rs *RuleSet) error { return rs.Add(netip.MustParsePrefix("10.66.0.0/16")) }); err != nil {
+		t.Fatalf("TestLayeredPolicy: %s", err)
+	}
+	ip.SetMode(ModeAllow)
+	if d := ip.DecideRule(netip.MustParseAddr("10.66.2.1")); d.Verdict != VerdictAllow || d.Rule.Action != ActionMode {
+		t.Fatalf("TestLayeredPolicy: The action was not replaced. Found `%+v`.", d)
+	}
+}
+
+func TestDecideRuleDoesNotAllocate(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeAllow)
+	if err := ip.Update(func(rs *RuleSet) error { return rs.AddDeny(netip.MustParsePrefix("10.66.0.0/16")) }); err != nil {
+		t.Fatalf("TestDecideRuleDoesNotAllocate: %s", err)
+	}
+	addr := netip.MustParseAddr("10.66.1.1")
+	if n := testing.AllocsPerRun(1000, func() { ip.DecideRule(addr) }); n != 0 {
+		t.Fatalf("TestDecideRuleDoesNotAllocate: Expected `0` allocations. Found `%v`.", n)
+	}
+}
+
+func TestNormalizeLayeredPolicy(t *testing.T) {
+	rs := newRuleSet(ModeAllow, nil)
+	for _, r := range []struct {
+		cidr   string
+		action Action
+	}{
+		{"10.0.0.0/8", ActionMode},
+		{"10.66.0.0/16", ActionDeny},
+		{"10.66.1.0/24", ActionMode},    // not covered: the nearest rule denies
+		{"10.66.2.0/24", ActionDeny},    // covered by 10.66.0.0/16
+		{"192.0.2.0/25", ActionAllow},   // merged
+		{"192.0.2.128/25", ActionAllow}, // merged
+		{"198.51.100.0/25", ActionMode}, // not merged: different actions
+		{"198.51.100.128/25", ActionDeny},
+	} {
+		if err := rs.AddAction(netip.MustParsePrefix(r.cidr), r.action); err != nil {
+			t.Fatalf("TestNormalizeLayeredPolicy: %s", err)
+		}
+	}
+	if err := rs.AddUntil(netip.MustParsePrefix("10.1.0.0/16"), ActionMode, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("TestNormalizeLayeredPolicy: %s", err)
+	}
+
+	report := rs.Normalize()
+	expected := NormalizeReport{Input: 8, Output: 6, Covered: 1, Merged: 1}
+	if report != expected {
+		t.Fatalf("TestNormalizeLayeredPolicy: Expected `%+v`. Found `%+v`.", expected, report)
+	}
+	found := ""
+	for _, r := range rs.Rules() {
+		found += r.String() + ":" + r.Action.String() + " "
+	}
+	if e := "10.0.0.0/8:mode 10.1.0.0/16:mode 10.66.0.0/16:deny 10.66.1.0/24:mode 192.0.2.0/24:allow 198.51.100.0/25:mode 198.51.100.128/25:deny "; found != e {
+		t.Fatalf("TestNormalizeLayeredPolicy: Expected `%s`. Found `%s`.", e, found)
+	}
+}
+
+// TestNormalizeLayeredPolicyRandom checks that the normalization of random rules never changes a verdict
+func TestNormalizeLayeredPolicyRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	rs := newRuleSet(ModeAllow, nil)
+	for _, p := range randomPrefixes(rnd, 2000) {
+		rs.AddAction(p, Action(rnd.Intn(3)))
+		// siblings so that there is something to merge
+		if p.Bits() > 0 && rnd.Intn(2) == 0 {
+			parent := netip.PrefixFrom(p.Addr(), p.Bits()-1).Masked()
+			rs.AddAction(netip.PrefixFrom(lastAddr(parent), p.Bits()).Masked(), rs.rules[p].Action)
+		}
+	}
+	before := newSnapshot(rs.Rules(), ModeAllow, 0)
+	report := rs.Normalize()
+	after := newSnapshot(rs.Rules(), ModeAllow, 0)
+	if report.Covered == 0 || report.Merged == 0 || report.Output != len(after.rules) {
+		t.Fatalf("TestNormalizeLayeredPolicyRandom: Unexpected report `%+v`.", report)
+	}
+
+	for n := 0; n < 20000; n++ {
+		addr := randomAddr(rnd)
+		if before.Decide(addr) != after.Decide(addr) {
+			t.Fatalf("TestNormalizeLayeredPolicyRandom: The verdict of `%s` changed. Before `%+v`. After `%+v`.", addr, before.Explain(addr), after.Explain(addr))
+		}
+	}
+}
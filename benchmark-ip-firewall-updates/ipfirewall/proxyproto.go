@@ -0,0 +1,126 @@
+package ipfirewall
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+/****************/
+/*  PROXY proto */
+/****************/
+
+// ErrInvalidProxyHeader is returned when a connection does not start with a valid PROXY protocol header
+var ErrInvalidProxyHeader = errors.New("ipfirewall: invalid proxy protocol header")
+
+// proxyV2Signature is the first 12 bytes of a PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107 // including the CRLF
+	proxyV2HeaderLen = 16  // signature, version/command, family/protocol and length
+)
+
+// readProxyHeader reads a PROXY protocol (v1 or v2) header and returns the source address and port of the client.
+// LOCAL (v2) and UNKNOWN (v1) headers (e.g. health checks of the proxy) and non-IP families return an invalid address,
+// the caller must use the address of the connection for them.
+// See https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+func readProxyHeader(r *bufio.Reader) (netip.AddrPort, error) {
+	peek, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	switch {
+	case bytes.Equal(peek, proxyV2Signature):
+		return readProxyV2Header(r)
+	case bytes.HasPrefix(peek, []byte(proxyV1Prefix)):
+		return readProxyV1Header(r)
+	}
+	return netip.AddrPort{}, ErrInvalidProxyHeader
+}
+
+// readProxyV1Header reads a human readable header like `PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n`
+func readProxyV1Header(r *bufio.Reader) (netip.AddrPort, error) {
+	line := make([]byte, 0, proxyV1MaxLength)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) == proxyV1MaxLength {
+			return netip.AddrPort{}, ErrInvalidProxyHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return netip.AddrPort{}, nil
+	}
+	if len(fields) != 6 {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+	src, err := netip.ParseAddr(fields[2])
+	if err != nil || src.Zone() != "" {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+	if (fields[1] == "TCP4" && !src.Is4()) || (fields[1] == "TCP6" && !src.Is6()) || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+	return netip.AddrPortFrom(src, uint16(port)), nil
+}
+
+// readProxyV2Header reads a binary header
+func readProxyV2Header(r *bufio.Reader) (netip.AddrPort, error) {
+	header := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return netip.AddrPort{}, err
+	}
+	verCmd, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return netip.AddrPort{}, err
+	}
+	if verCmd>>4 != 2 {
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL
+		return netip.AddrPort{}, nil
+	case 0x1: // PROXY
+	default:
+		return netip.AddrPort{}, ErrInvalidProxyHeader
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET: source and destination addresses and ports
+		if len(payload) < 12 {
+			return netip.AddrPort{}, ErrInvalidProxyHeader
+		}
+		return netip.AddrPortFrom(netip.AddrFrom4([4]byte(payload[:4])), binary.BigEndian.Uint16(payload[8:10])), nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return netip.AddrPort{}, ErrInvalidProxyHeader
+		}
+		return netip.AddrPortFrom(netip.AddrFrom16([16]byte(payload[:16])).Unmap(), binary.BigEndian.Uint16(payload[32:34])), nil
+	}
+	// AF_UNSPEC and AF_UNIX
+	return netip.AddrPort{}, nil
+}
@@ -0,0 +1,376 @@
+package ipfirewall
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+/****************/
+/*     Rule     */
+/****************/
+
+// Rule is a single CIDR entry of the firewall
+type Rule struct {
+	Prefix   netip.Prefix
+	Expires  time.Time     // zero for permanent rules
+	Action   Action        // ActionMode for the rules of an allowlist or a blocklist
+	counters *ruleCounters // shared by all the snapshots containing the rule
+}
+
+// String returns the CIDR notation of the rule
+func (r Rule) String() string {
+	return r.Prefix.String()
+}
+
+// IsTemporary reports whether the rule has an expiry time
+func (r Rule) IsTemporary() bool {
+	return !r.Expires.IsZero()
+}
+
+// isExpired reports whether a temporary rule has expired at a given time
+func (r Rule) isExpired(now time.Time) bool {
+	return r.IsTemporary() && !now.Before(r.Expires)
+}
+
+/****************/
+/*    RuleSet   */
+/****************/
+
+// RuleSet is a mutable set of rules. It is only used to build the next snapshot of the firewall (see IPFirewall.Update)
+// and must not be retained after the update function returns.
+type RuleSet struct {
+	mode     FWMode
+	rules    map[netip.Prefix]Rule
+	counters map[netip.Prefix]*ruleCounters // counters of the previous snapshot (kept if a rule is removed and added again)
+}
+
+func newRuleSet(mode FWMode, rules []Rule) *RuleSet {
+	rs := &RuleSet{
+		mode:     mode,
+		rules:    make(map[netip.Prefix]Rule, len(rules)),
+		counters: make(map[netip.Prefix]*ruleCounters, len(rules)),
+	}
+	for _, r := range rules {
+		rs.rules[r.Prefix] = r
+		rs.counters[r.Prefix] = r.counters
+	}
+	return rs
+}
+
+// Mode returns the mode of the rule set
+func (rs *RuleSet) Mode() FWMode {
+	return rs.mode
+}
+
+// SetMode changes the mode of the rule set, so the mode and the rules can be swapped in together.
+// It returns ErrInvalidMode for an unknown mode.
+func (rs *RuleSet) SetMode(m FWMode) error {
+	if !m.valid() {
+		return ErrInvalidMode
+	}
+	rs.mode = m
+	return nil
+}
+
+// Add adds a permanent prefix that follows the mode of the firewall to the rule set (see AddAction).
+// The prefix is masked, so `10.1.2.3/8` is stored as `10.0.0.0/8`. Adding a prefix that is already present makes it permanent.
+func (rs *RuleSet) Add(p netip.Prefix) error {
+	return rs.AddAction(p, ActionMode)
+}
+
+// AddUntil adds a temporary prefix with an action that is removed by the janitor once it expires (see IPFirewall.RunJanitor).
+// The action and the expiry of a temporary prefix that is already present are replaced. A permanent prefix is
+// left unchanged and ErrPermanentRule is returned.
+func (rs *RuleSet) AddUntil(p netip.Prefix, a Action, expires time.Time) error {
+	if expires.IsZero() {
+		return ErrInvalidTTL
+	}
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return ErrInvalidNetwork
+	}
+	r, ok := rs.rules[p]
+	if ok && !r.IsTemporary() {
+		return ErrPermanentRule
+	}
+	if !ok {
+		r = Rule{Prefix: p, counters: rs.counters[p]}
+	}
+	r.Expires = expires
+	r.Action = a
+	rs.rules[p] = r
+	return nil
+}
+
+// AddCIDR parses a CIDR (or a single address) and adds it to the rule set
+func (rs *RuleSet) AddCIDR(cidr string) error {
+	p, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	return rs.Add(p)
+}
+
+// AddRange adds the minimal list of permanent prefixes covering an IP range (see RangeToPrefixes)
+func (rs *RuleSet) AddRange(start, end netip.Addr) error {
+	prefixes, err := RangeToPrefixes(start, end)
+	if err != nil {
+		return err
+	}
+	for _, p := range prefixes {
+		if err := rs.Add(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes a prefix from the rule set and reports whether it was present
+func (rs *RuleSet) Remove(p netip.Prefix) bool {
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return false
+	}
+	if _, ok := rs.rules[p]; !ok {
+		return false
+	}
+	delete(rs.rules, p)
+	return true
+}
+
+// Contains reports whether the prefix is a rule of the rule set
+func (rs *RuleSet) Contains(p netip.Prefix) bool {
+	p, ok := canonicalPrefix(p)
+	if !ok {
+		return false
+	}
+	_, ok = rs.rules[p]
+	return ok
+}
+
+// Reset removes all the rules
+func (rs *RuleSet) Reset() {
+	rs.rules = make(map[netip.Prefix]Rule)
+}
+
+// ResetPermanent removes all the permanent rules and keeps the temporary rules
+func (rs *RuleSet) ResetPermanent() {
+	for p, r := range rs.rules {
+		if !r.IsTemporary() {
+			delete(rs.rules, p)
+		}
+	}
+}
+
+// ResetModeRules removes the permanent rules that follow the mode (e.g. the rules of a blocklist file)
+// and keeps the explicit allow and deny rules and the temporary rules
+func (rs *RuleSet) ResetModeRules() {
+	for p, r := range rs.rules {
+		if !r.IsTemporary() && r.Action == ActionMode {
+			delete(rs.rules, p)
+		}
+	}
+}
+
+// isAPIRule reports whether the prefix is a rule owned by the API: a permanent explicit allow or deny rule or a temporary rule
+func (rs *RuleSet) isAPIRule(p netip.Prefix) bool {
+	r, ok := rs.rules[p]
+	return ok && (r.IsTemporary() || r.Action != ActionMode)
+}
+
+// RemoveExpired removes the temporary rules that have expired at a given time and returns the number of removed rules
+func (rs *RuleSet) RemoveExpired(now time.Time) int {
+	removed := 0
+	for p, r := range rs.rules {
+		if r.isExpired(now) {
+			delete(rs.rules, p)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of rules
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Rules returns a sorted copy of the rules (IPv4 before IPv6, then by address and prefix length)
+func (rs *RuleSet) Rules() []Rule {
+	rules := make([]Rule, 0, len(rs.rules))
+	for _, r := range rs.rules {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(a, b int) bool {
+		return comparePrefix(rules[a].Prefix, rules[b].Prefix) < 0
+	})
+	return rules
+}
+
+/****************/
+/*   Snapshot   */
+/****************/
+
+// Snapshot is an immutable version of the rules of a firewall.
+// A snapshot is swapped in with a single atomic store, so its version always matches its rules.
+type Snapshot struct {
+	version    uint64
+	mode       FWMode
+	rules      []Rule
+	tree       *ipTree
+	nextExpiry time.Time // earliest expiry of the temporary rules (zero if there are none)
+}
+
+// newSnapshot builds a snapshot and takes ownership of the rules. New rules get their hit counters here.
+func newSnapshot(rules []Rule, mode FWMode, version uint64) *Snapshot {
+	for idx := range rules {
+		if rules[idx].counters == nil {
+			rules[idx].counters = newRuleCounters()
+		}
+	}
+	return buildSnapshot(rules, mode, version)
+}
+
+// buildSnapshot builds a snapshot without giving hit counters to the new rules (e.g. for the shadow snapshot
+// of a dry run, whose decisions are never counted per rule)
+func buildSnapshot(rules []Rule, mode FWMode, version uint64) *Snapshot {
+	prefixes := make([]netip.Prefix, len(rules))
+	var nextExpiry time.Time
+	for idx := range rules {
+		prefixes[idx] = rules[idx].Prefix
+		if exp := rules[idx].Expires; !exp.IsZero() && (nextExpiry.IsZero() || exp.Before(nextExpiry)) {
+			nextExpiry = exp
+		}
+	}
+	return &Snapshot{
+		version:    version,
+		mode:       mode,
+		rules:      rules,
+		tree:       newIPTree(prefixes),
+		nextExpiry: nextExpiry,
+	}
+}
+
+// withVersion returns a copy of the snapshot with a new version (the rules and the tree are shared)
+func (s *Snapshot) withVersion(version uint64) *Snapshot {
+	c := *s
+	c.version = version
+	return &c
+}
+
+// withMode returns a copy of the snapshot with a new mode and version (the rules and the tree are shared)
+func (s *Snapshot) withMode(mode FWMode, version uint64) *Snapshot {
+	c := *s
+	c.mode = mode
+	c.version = version
+	return &c
+}
+
+// Version returns the version of the snapshot
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Mode returns the mode of the firewall in the snapshot
+func (s *Snapshot) Mode() FWMode {
+	return s.mode
+}
+
+// Decide returns the verdict of the snapshot for an address.
+// A disabled firewall allows everything, an allowlist only allows the addresses in the list and
+// a blocklist denies the addresses in the list. Explicit allow and deny rules override the mode for their addresses
+// (the most specific rule wins, see Explain). Lookups are lock-free and do not allocate.
+// Decisions of a snapshot are not counted (see IPFirewall.Decide).
+func (s *Snapshot) Decide(addr netip.Addr) Verdict {
+	if s.mode == ModeDisabled {
+		return VerdictAllow
+	}
+	return s.verdict(s.tree.lookup(addr))
+}
+
+// verdict returns the verdict for the result of a lookup
+func (s *Snapshot) verdict(rule int) Verdict {
+	if rule != noRule {
+		switch s.rules[rule].Action {
+		case ActionAllow:
+			return VerdictAllow
+		case ActionDeny:
+			return VerdictDeny
+		}
+	}
+	switch s.mode {
+	case ModeAllow:
+		if rule != noRule {
+			return VerdictAllow
+		}
+		return VerdictDeny
+	case ModeBlock:
+		if rule != noRule {
+			return VerdictDeny
+		}
+		return VerdictAllow
+	}
+	return VerdictAllow
+}
+
+// Rules returns a copy of the rules in the snapshot
+func (s *Snapshot) Rules() []Rule {
+	return append([]Rule(nil), s.rules...)
+}
+
+// Match returns the most specific rule containing the address
+func (s *Snapshot) Match(addr netip.Addr) (Rule, bool) {
+	idx := s.tree.lookup(addr)
+	if idx == noRule {
+		return Rule{}, false
+	}
+	return s.rules[idx], true
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// canonicalPrefix validates and masks a prefix. IPv4-mapped IPv6 prefixes (at least /96) are converted to IPv4.
+func canonicalPrefix(p netip.Prefix) (netip.Prefix, bool) {
+	if !p.IsValid() || p.Addr().Zone() != "" {
+		return netip.Prefix{}, false
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), true
+}
+
+// parsePrefix parses a CIDR or a single address (as a /32 or /128 prefix)
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Prefix{}, ErrInvalidNetwork
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// comparePrefix orders IPv4 prefixes before IPv6 prefixes, then by address and by prefix length
+func comparePrefix(a, b netip.Prefix) int {
+	if a.Addr().BitLen() != b.Addr().BitLen() {
+		return a.Addr().BitLen() - b.Addr().BitLen()
+	}
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// ipNetFromPrefix converts a prefix into a net.IPNet
+func ipNetFromPrefix(p netip.Prefix) net.IPNet {
+	return net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
@@ -0,0 +1,208 @@
+package ipfirewall
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+/****************/
+/*     Tests    */
+/****************/
+
+func TestRuleSet(t *testing.T) {
+	rs := newRuleSet(ModeDisabled, nil)
+	for _, c := range []string{"10.1.2.3/8", "192.0.2.1", "2001:db8::/32", "::ffff:198.51.100.0/120", "10.0.0.0/8"} {
+		if err := rs.AddCIDR(c); err != nil {
+			t.Fatalf("TestRuleSet: Unexpected error for `%s`: %s", c, err)
+		}
+	}
+	if err := rs.AddCIDR("10.0.0.0/33"); err != ErrInvalidNetwork {
+		t.Fatalf("TestRuleSet: Expected `%v`. Found `%v`.", ErrInvalidNetwork, err)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.0.2.1/32", "198.51.100.0/24", "2001:db8::/32"}
+	rules := rs.Rules()
+	if len(rules) != len(expected) {
+		t.Fatalf("TestRuleSet: Unexpected rules. Expected `%v`. Found `%v`.", expected, rules)
+	}
+	for idx, r := range rules {
+		if r.String() != expected[idx] {
+			t.Fatalf("TestRuleSet: Unexpected rule at `%d`. Expected `%s`. Found `%s`.", idx, expected[idx], r)
+		}
+	}
+
+	if !rs.Remove(netip.MustParsePrefix("10.0.0.0/8")) || rs.Remove(netip.MustParsePrefix("10.0.0.0/8")) {
+		t.Fatalf("TestRuleSet: A rule must only be removed once.")
+	}
+	if rs.Contains(netip.MustParsePrefix("10.0.0.0/8")) || rs.Len() != len(expected)-1 {
+		t.Fatalf("TestRuleSet: The rule was not removed. Found `%v`.", rs.Rules())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	if err := ip.Update(func(rs *RuleSet) error {
+		return rs.AddCIDR("10.0.0.0/8")
+	}); err != nil {
+		t.Fatalf("TestUpdate: %s", err)
+	}
+	s := ip.Snapshot()
+	if s.Version() != 1 || ip.ReadVersion() != 1 || len(s.Rules()) != 1 {
+		t.Fatalf("TestUpdate: Unexpected snapshot. Version `%d`. Rules `%v`.", s.Version(), s.Rules())
+	}
+
+	// a failed update must not change the snapshot
+	errUpdate := errors.New("failed update")
+	if err := ip.Update(func(rs *RuleSet) error {
+		rs.Reset()
+		return errUpdate
+	}); err != errUpdate {
+		t.Fatalf("TestUpdate: Expected `%v`. Found `%v`.", errUpdate, err)
+	}
+	if ip.Snapshot() != s || ip.ReadVersion() != 1 {
+		t.Fatalf("TestUpdate: A failed update changed the snapshot.")
+	}
+
+	// the old snapshot is never modified by the updates
+	if err := ip.Update(func(rs *RuleSet) error {
+		rs.Reset()
+		return rs.AddCIDR("192.0.2.0/24")
+	}); err != nil {
+		t.Fatalf("TestUpdate: %s", err)
+	}
+	if _, ok := s.Match(netip.MustParseAddr("10.1.1.1")); !ok {
+		t.Fatalf("TestUpdate: The previous snapshot was modified.")
+	}
+	if r, ok := ip.Snapshot().Match(netip.MustParseAddr("192.0.2.1")); !ok || r.String() != "192.0.2.0/24" {
+		t.Fatalf("TestUpdate: Unexpected match `%s` in the new snapshot.", r)
+	}
+
+	// incrementing the version keeps the rules
+	ip.IncVersion()
+	if ip.ReadVersion() != 3 || len(ip.Snapshot().Rules()) != 1 {
+		t.Fatalf("TestUpdate: Unexpected snapshot after IncVersion. Version `%d`. Rules `%v`.", ip.ReadVersion(), ip.Snapshot().Rules())
+	}
+}
+
+// TestConcurrentUpdates swaps thousands of snapshots while readers check that the version of every snapshot
+// matches its rules (the n-th update replaces the rules with the n-th address). Run it with the race detector.
+func TestConcurrentUpdates(t *testing.T) {
+	const updates = 5000
+	const readers = 8
+
+	ip := NewIPFirewallWithMode(ModeAllow)
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, readers)
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := ip.Snapshot()
+				v := s.Version()
+				if v < last {
+					errs <- errors.New("the version went backwards")
+					return
+				}
+				last = v
+				if v == 0 {
+					continue
+				}
+				if len(s.rules) != 1 || s.rules[0].Prefix.Addr() != testAddr(int(v)) {
+					errs <- errors.New("the version does not match the rules")
+					return
+				}
+				if _, ok := s.Match(testAddr(int(v))); !ok {
+					errs <- errors.New("the tree does not match the rules")
+					return
+				}
+				if ip.ReadVersion() < v {
+					errs <- errors.New("ReadVersion is older than the snapshot")
+					return
+				}
+			}
+		}()
+	}
+
+	for n := 1; n <= updates; n++ {
+		addr := testAddr(n)
+		if err := ip.Update(func(rs *RuleSet) error {
+			rs.Reset()
+			return rs.Add(netip.PrefixFrom(addr, 32))
+		}); err != nil {
+			t.Fatalf("TestConcurrentUpdates: %s", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("TestConcurrentUpdates: %s", err)
+	}
+	if ip.ReadVersion() != updates {
+		t.Fatalf("TestConcurrentUpdates: Expected version `%d`. Found `%d`.", updates, ip.ReadVersion())
+	}
+}
+
+/****************/
+/*    Helpers   */
+/****************/
+
+// testAddr returns a unique IPv4 address for a number
+func testAddr(n int) netip.Addr {
+	return netip.AddrFrom4([4]byte{10, byte(n >> 16), byte(n >> 8), byte(n)})
+}
+
+/****************/
+/*  Benchmarks  */
+/****************/
+
+// BenchmarkUpdate measures the cost of building and swapping a small snapshot
+func BenchmarkUpdate(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	for i := 0; i < b.N; i++ {
+		addr := testAddr(i)
+		ip.Update(func(rs *RuleSet) error {
+			rs.Reset()
+			return rs.Add(netip.PrefixFrom(addr, 32))
+		})
+	}
+}
+
+func BenchmarkParallelDecideDuringUpdates(b *testing.B) {
+	ip := NewIPFirewallWithMode(ModeBlock)
+	done := make(chan struct{})
+	go func() {
+		for n := 0; ; n++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			addr := testAddr(n % 1000)
+			ip.Update(func(rs *RuleSet) error {
+				return rs.Add(netip.PrefixFrom(addr, 32))
+			})
+		}
+	}()
+	defer close(done)
+
+	addr := testAddr(500)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ip.Decide(addr)
+		}
+	})
+}
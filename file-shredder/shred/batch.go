@@ -0,0 +1,135 @@
+package shreder
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"runtime"
+	"sync"
+)
+
+/***********/
+/*  Batch  */
+/***********/
+
+// BatchOptions are the options of ShredBatch and ShredChan
+type BatchOptions struct {
+	Options     // options of every file
+	Workers int // number of files shredded concurrently (the number of CPUs by default)
+}
+
+func (o BatchOptions) workers() int {
+	if o.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+// ShredBatch shreds files with a pool of workers. The error joins (errors.Join) a *ShredError with the path of every
+// file that could not be shredded, in the order of the paths. When the context is canceled, the files being shredded
+// stop before their next chunk (they are left partially overwritten) and the other files are not shredded:
+// all of them fail with ErrShredderCanceled.
+func ShredBatch(ctx context.Context, paths []string, opts BatchOptions) error {
+	if len(opts.passes()) == 0 {
+		return newShredError(ErrInvalidIterationCount)
+	}
+	jobs := make(chan int, len(paths))
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := shredContext(ctx, paths[i], opts.Options); err != nil {
+					errs[i] = err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ShredChan shreds the files received from a channel with a pool of workers until the channel is closed or the
+// context is canceled (the paths left in the channel are not read). The error joins a *ShredError with the path of
+// every file that could not be shredded, in the order of completion (see ShredBatch for the cancellation).
+func ShredChan(ctx context.Context, paths <-chan string, opts BatchOptions) error {
+	if len(opts.passes()) == 0 {
+		return newShredError(ErrInvalidIterationCount)
+	}
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case path, ok := <-paths:
+					if !ok {
+						return
+					}
+					if err := shredContext(ctx, path, opts.Options); err != nil {
+						mu.Lock()
+						errs = append(errs, err)
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// shredContext shreds a file until the context is canceled and returns a *ShredError with its path
+func shredContext(ctx context.Context, path string, opts Options) error {
+	if err := ctx.Err(); err != nil {
+		return pathError(path, err)
+	}
+	passes := opts.passes()
+	for i, pass := range passes {
+		passes[i] = contextPass{ctx, pass}
+	}
+	opts.Passes, opts.Zero = passes, false
+	return pathError(path, shredFile(osFS{}, path, opts))
+}
+
+// contextPass stops a pass before the next chunk when the context is canceled
+type contextPass struct {
+	ctx  context.Context
+	pass Pass
+}
+
+func (p contextPass) Fill(buf []byte, offset int64) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	return p.pass.Fill(buf, offset)
+}
+
+// pathError returns an error as a *ShredError with the path of the file (nil if err is nil)
+func pathError(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *ShredError
+	switch {
+	case errors.As(err, &se):
+		return &ShredError{Code: se.Code, Path: path, Err: se.Err}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return &ShredError{Code: ErrShredderCanceled, Path: path, Err: err}
+	case errors.Is(err, fs.ErrNotExist):
+		return &ShredError{Code: ErrPathNotExists, Path: path, Err: err}
+	}
+	return &ShredError{Code: ErrShredderIOFailure, Path: path, Err: err}
+}
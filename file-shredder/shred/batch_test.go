@@ -0,0 +1,145 @@
+package shreder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+/*****************/
+/*    Helpers    */
+/*****************/
+
+// createTempFiles creates n files in a temporary directory
+func createTempFiles(t *testing.T, n int, data []byte) []string {
+	dir := t.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, tmpFilePrefix+strconv.Itoa(i))
+		if err := os.WriteFile(paths[i], data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// shredErrors returns the *ShredError of every error joined by a batch
+func shredErrors(t *testing.T, err error) []*ShredError {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("batch, expected: joined errors, found: %v", err)
+	}
+	var errs []*ShredError
+	for _, err := range joined.Unwrap() {
+		var se *ShredError
+		if !errors.As(err, &se) {
+			t.Fatalf("batch, expected: *ShredError, found: %v", err)
+		}
+		errs = append(errs, se)
+	}
+	return errs
+}
+
+// cancelPass cancels a context when it fills its first chunk
+type cancelPass struct {
+	cancel context.CancelFunc
+}
+
+func (p cancelPass) Fill(buf []byte, offset int64) error {
+	p.cancel()
+	return ZeroPass().Fill(buf, offset)
+}
+
+/*****************/
+/*  Integration  */
+/*****************/
+
+// Test - Shred Batch - All the files are deleted
+func TestShredBatch(t *testing.T) {
+	paths := createTempFiles(t, 50, []byte("abcdefghijklmonpqrstuvwxyz"))
+	if err := ShredBatch(context.Background(), paths, BatchOptions{Options: Options{Passes: RandomPasses(1)}, Workers: 4}); err != nil {
+		t.Fatalf("ShredBatch, expected no error, found: %v", err)
+	}
+	for _, path := range paths {
+		verifyPathExists(t, path, false)
+	}
+}
+
+// Test - Shred Batch - Every failing path is reported with its code
+func TestShredBatchErrors(t *testing.T) {
+	paths := createTempFiles(t, 3, []byte("abc"))
+	missing := filepath.Join(t.TempDir(), "missing")
+	dir := t.TempDir()
+	err := ShredBatch(context.Background(), append(paths, missing, dir), BatchOptions{Options: Options{Passes: RandomPasses(1)}})
+
+	errs := shredErrors(t, err)
+	if len(errs) != 2 {
+		t.Fatalf("ShredBatch, expected: 2 errors, found: %v", err)
+	}
+	if errs[0].Path != missing || errs[0].Code != ErrPathNotExists || !errors.Is(errs[0], os.ErrNotExist) {
+		t.Fatalf("ShredBatch for path: %s, expected: %s, found: %v", missing, errPathNotExists, errs[0])
+	}
+	if errs[1].Path != dir || errs[1].Code != ErrPathIsNotARegularFile {
+		t.Fatalf("ShredBatch for path: %s, expected: %s, found: %v", dir, errPathIsNotAShredableFile, errs[1])
+	}
+	for _, path := range paths {
+		verifyPathExists(t, path, false)
+	}
+}
+
+// Test - Shred Batch - A canceled batch stops in the middle of a file and shreds no other file
+func TestShredBatchCancel(t *testing.T) {
+	paths := createTempFiles(t, 3, bytes.Repeat([]byte("a"), 4*bufferSize))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := ShredBatch(ctx, paths, BatchOptions{Options: Options{Passes: []Pass{cancelPass{cancel}}}, Workers: 1})
+
+	errs := shredErrors(t, err)
+	if len(errs) != len(paths) {
+		t.Fatalf("ShredBatch, expected: %d errors, found: %v", len(paths), err)
+	}
+	for i, se := range errs {
+		if se.Path != paths[i] || se.Code != ErrShredderCanceled || !errors.Is(se, context.Canceled) {
+			t.Fatalf("ShredBatch for path: %s, expected: %s, found: %v", paths[i], errShredderCanceled, se)
+		}
+		verifyPathExists(t, paths[i], true)
+	}
+	// the first file was stopped after its first chunk
+	filedata, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filedata[0] != 0x00 || filedata[bufferSize] != 'a' {
+		t.Fatalf("after cancel for path: %s, expected: the first chunk only, found: %x %x", paths[0], filedata[0], filedata[bufferSize])
+	}
+}
+
+// Test - Shred Chan - The files of a channel are deleted and a canceled context stops an open channel
+func TestShredChan(t *testing.T) {
+	paths := createTempFiles(t, 20, []byte("abcdefghijklmonpqrstuvwxyz"))
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, path := range append(paths, filepath.Join(t.TempDir(), "missing")) {
+			ch <- path
+		}
+	}()
+	errs := shredErrors(t, ShredChan(context.Background(), ch, BatchOptions{Options: Options{Passes: RandomPasses(1)}, Workers: 4}))
+	if len(errs) != 1 || errs[0].Code != ErrPathNotExists {
+		t.Fatalf("ShredChan, expected: 1 missing path, found: %v", errs)
+	}
+	for _, path := range paths {
+		verifyPathExists(t, path, false)
+	}
+
+	// the channel is never closed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ShredChan(ctx, make(chan string), BatchOptions{Options: Options{Passes: RandomPasses(1)}}); err != nil {
+		t.Fatalf("ShredChan after cancel, expected no error, found: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package shreder
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+/***************/
+/*  Obfuscate  */
+/***************/
+
+// nameChars are the characters of the random names
+const nameChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// nameAttempts is the number of random names tried for every length before the length is skipped
+const nameAttempts = 64
+
+// obfuscateName renames a file to random names from the length of its name down to a single character and syncs
+// the parent directory after every rename, so that the directory keeps no trace of the original name. It returns the
+// final path of the file. A length is skipped if no free name is found (e.g. all the names of 1 character exist).
+func obfuscateName(fsys fileSystem, path string) (string, error) {
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	current := path
+	for n := len(name); n > 0; n-- {
+		next, err := renameRandom(fsys, current, dir, name, n)
+		if err != nil {
+			return current, err
+		}
+		if next == "" {
+			continue
+		}
+		current = next
+		if err := syncDir(fsys, dir); err != nil {
+			return current, err
+		}
+	}
+	return current, nil
+}
+
+// renameRandom renames a file to a random name of n characters in its directory that is not the original name and
+// returns its new path, or an empty path if no free name is found. A rename never replaces an existing file, also
+// when the name is created by another goroutine or process in the meantime (see renameNoReplace).
+func renameRandom(fsys fileSystem, path, dir, original string, n int) (string, error) {
+	buf := make([]byte, n)
+	for i := 0; i < nameAttempts; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for j := range buf {
+			buf[j] = nameChars[int(buf[j])%len(nameChars)]
+		}
+		if string(buf) == original {
+			continue
+		}
+		candidate := filepath.Join(dir, string(buf))
+		err := renameNoReplace(fsys, path, candidate)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return candidate, nil
+	}
+	return "", nil
+}
+
+// renameNoReplace renames a file to a new name in the same directory and fails with fs.ErrExist if the new name
+// exists (os.Rename replaces it). The rename is atomic where the system supports it (renameat2 with RENAME_NOREPLACE
+// on Linux). Elsewhere the file is hard linked to the new name, which fails if the name exists, and the old name
+// is removed: this needs a filesystem with hard links (and fails under fs.protected_hardlinks for a file owned by
+// another user).
+func renameNoReplace(fsys fileSystem, oldpath, newpath string) error {
+	err := renameExclusive(fsys, oldpath, newpath)
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	if err := fsys.link(oldpath, newpath); err != nil {
+		return err
+	}
+	if err := fsys.remove(oldpath); err != nil {
+		fsys.remove(newpath) // the file keeps its previous name
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes a directory so that its entries (the renames) are written to the disk
+func syncDir(fsys fileSystem, dir string) error {
+	fh, err := fsys.open(dir, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	return fh.Sync()
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package shreder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameExclusive renames a file within its directory with renameat2 and RENAME_NOREPLACE, relative to the directory
+// opened through the file system (so a rootFS never leaves its root). It returns errors.ErrUnsupported if the kernel
+// (before 3.15) or the filesystem does not support RENAME_NOREPLACE.
+func renameExclusive(fsys fileSystem, oldpath, newpath string) error {
+	dir, err := fsys.open(filepath.Dir(oldpath), os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	fd := int(dir.Fd())
+	err = unix.Renameat2(fd, filepath.Base(oldpath), fd, filepath.Base(newpath), unix.RENAME_NOREPLACE)
+	switch err {
+	case nil:
+		return nil
+	case unix.ENOSYS, unix.EINVAL:
+		return errors.ErrUnsupported
+	}
+	return &os.LinkError{Op: "renameat2", Old: oldpath, New: newpath, Err: err}
+}
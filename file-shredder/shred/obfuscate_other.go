@@ -0,0 +1,10 @@
+//go:build !linux
+
+package shreder
+
+import "errors"
+
+// renameExclusive is not supported outside of Linux, the files are renamed with a hard link (see renameNoReplace)
+func renameExclusive(fsys fileSystem, oldpath, newpath string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,197 @@
+package shreder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*****************/
+/*  Unit Tests   */
+/*****************/
+
+// (Unit Test) Test - Obfuscate Name - The file is renamed down to a single character and never keeps its original name
+func TestObfuscateName(t *testing.T) {
+	data := []byte("abcdefghijklmonpqrstuvwxyz")
+	dir := t.TempDir()
+	for _, name := range []string{"a", "0", "ab", "tmpfile-12345", "secret report.pdf"} {
+		// a name of 1 character has a single rename, so it is repeated to catch a random name equal to the original
+		for i := 0; i < 20; i++ {
+			path := filepath.Join(dir, name)
+			writeTreeFile(t, path, data)
+			final, err := obfuscateName(osFS{}, path)
+			if err != nil {
+				t.Fatalf("obfuscateName for path: %s, expected: no error, found: %v", path, err)
+			}
+			if filepath.Dir(final) != dir {
+				t.Fatalf("obfuscateName for path: %s, expected dir: %s, found: %s", path, dir, filepath.Dir(final))
+			}
+			if base := filepath.Base(final); base == name || len(base) != 1 {
+				t.Fatalf("obfuscateName for path: %s, expected: a new name of 1 character, found: %s", path, base)
+			}
+			verifyPathExists(t, path, false)
+			found, err := os.ReadFile(final)
+			if err != nil || !bytes.Equal(found, data) {
+				t.Fatalf("obfuscateName for path: %s, expected: %s, found: %s (%v)", path, data, found, err)
+			}
+			if err := os.Remove(final); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// (Unit Test) Test - Obfuscate Name - The existing files are never replaced by a rename
+func TestObfuscateNameExisting(t *testing.T) {
+	dir := t.TempDir()
+	// every name of 1 character but one exists
+	for _, c := range nameChars[1:] {
+		writeTreeFile(t, filepath.Join(dir, string(c)), []byte{byte(c)})
+	}
+	path := filepath.Join(dir, "file")
+	writeTreeFile(t, path, []byte("data"))
+
+	final, err := obfuscateName(osFS{}, path)
+	if err != nil {
+		t.Fatalf("obfuscateName for path: %s, expected: no error, found: %v", path, err)
+	}
+	if base := filepath.Base(final); base == "file" || len(base) > 2 {
+		t.Fatalf("obfuscateName for path: %s, expected: a new name of at most 2 characters, found: %s", path, base)
+	}
+	for _, c := range nameChars[1:] {
+		name := filepath.Join(dir, string(c))
+		if found, err := os.ReadFile(name); err != nil || !bytes.Equal(found, []byte{byte(c)}) {
+			t.Fatalf("obfuscateName for path: %s, expected: %c, found: %s (%v)", name, c, found, err)
+		}
+	}
+}
+
+// (Unit Test) Test - Obfuscate Name - Concurrent renames in the same directory never replace each other's files
+func TestObfuscateNameConcurrent(t *testing.T) {
+	// more files than names of 1 character, so that the goroutines compete for the same names
+	paths := createTempFiles(t, 100, nil)
+	for i, path := range paths {
+		writeTreeFile(t, path, []byte(strconv.Itoa(i)))
+	}
+
+	finals := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			finals[i], errs[i] = obfuscateName(osFS{}, path)
+		}()
+	}
+	wg.Wait()
+
+	for i, path := range paths {
+		if errs[i] != nil {
+			t.Fatalf("obfuscateName for path: %s, expected: no error, found: %v", path, errs[i])
+		}
+		if filepath.Base(finals[i]) == filepath.Base(path) {
+			t.Fatalf("obfuscateName for path: %s, expected: a new name, found: %s", path, finals[i])
+		}
+		// every file still has its own content under its final name
+		if found, err := os.ReadFile(finals[i]); err != nil || string(found) != strconv.Itoa(i) {
+			t.Fatalf("obfuscateName for path: %s, expected: %d, found: %s (%v)", path, i, found, err)
+		}
+	}
+}
+
+/*****************/
+/*  Integration  */
+/*****************/
+
+// Test - Shred Batch - With Obfuscate, concurrent workers shred all the files of a directory
+func TestShredBatchObfuscate(t *testing.T) {
+	paths := createTempFiles(t, 300, []byte("abcdefghijklmonpqrstuvwxyz"))
+	opts := BatchOptions{Options: Options{Passes: RandomPasses(1), Obfuscate: true}, Workers: 32}
+	if err := ShredBatch(context.Background(), paths, opts); err != nil {
+		t.Fatalf("ShredBatch, expected no error, found: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(paths[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("ShredBatch, expected: empty dir, found: %d entries", len(entries))
+	}
+}
+
+// Test - Shred With Options - With Obfuscate, the file is deleted and nothing is left in its directory
+func TestShredObfuscate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeTreeFile(t, path, []byte("abcdefghijklmonpqrstuvwxyz"))
+
+	if err := ShredWithOptions(path, Options{Passes: RandomPasses(1), Zero: true, Verify: true, Obfuscate: true}); err != nil {
+		t.Fatalf("ShredWithOptions for path: %s, expected: no error, found: %v", path, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("ShredWithOptions for path: %s, expected: empty dir, found: %d entries", path, len(entries))
+	}
+}
+
+// failingDirFS fails to open a directory once it has been opened a number of times (e.g. to sync a rename)
+type failingDirFS struct {
+	osFS
+	dir   string
+	opens int
+}
+
+func (f *failingDirFS) open(name string, flag int) (*os.File, error) {
+	if name == f.dir {
+		if f.opens == 0 {
+			return nil, errors.New("injected failure")
+		}
+		f.opens--
+	}
+	return f.osFS.open(name, flag)
+}
+
+// Test - Shred With Options - With Obfuscate, a file whose rename fails is still deleted under its current name
+func TestShredObfuscateFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeTreeFile(t, path, []byte("abcdefghijklmonpqrstuvwxyz"))
+
+	// the first rename succeeds and the sync of the directory fails
+	err := shredFile(&failingDirFS{dir: dir, opens: 1}, path, Options{Passes: RandomPasses(1), Obfuscate: true})
+	if err == nil || !strings.Contains(err.Error(), "renamed to "+dir) {
+		t.Fatalf("shredFile for path: %s, expected: an error with the current path, found: %v", path, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("shredFile for path: %s, expected: empty dir, found: %d entries", path, len(entries))
+	}
+}
+
+// Test - Shred Tree - With Obfuscate, the files are renamed inside the root and the tree is removed
+func TestShredTreeObfuscate(t *testing.T) {
+	root := t.TempDir()
+	writeTreeFile(t, filepath.Join(root, "a"), []byte("data"))
+	writeTreeFile(t, filepath.Join(root, "sub", "deeper", "report.txt"), []byte("data"))
+
+	report, err := ShredTree(root, Options{Passes: RandomPasses(1), Obfuscate: true})
+	if err != nil {
+		t.Fatalf("ShredTree for path: %s, expected: no error, found: %v", root, err)
+	}
+	verifyTreeResult(t, report, filepath.Join(root, "a"), FileShredded)
+	verifyTreeResult(t, report, filepath.Join(root, "sub", "deeper", "report.txt"), FileShredded)
+	verifyPathExists(t, root, false)
+}
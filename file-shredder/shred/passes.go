@@ -0,0 +1,101 @@
+package shreder
+
+import (
+	"crypto/rand"
+)
+
+/************/
+/*  Passes  */
+/************/
+
+// Pass is a strategy to overwrite a file once. Fill is called with consecutive chunks of the file
+// and writes the bytes of the pass for the chunk starting at offset into buf.
+type Pass interface {
+	Fill(buf []byte, offset int64) error
+}
+
+// randomPass overwrites a file with random bytes from crypto/rand
+type randomPass struct{}
+
+func (randomPass) Fill(buf []byte, offset int64) error {
+	_, err := rand.Read(buf)
+	return err
+}
+
+// patternPass overwrites a file with a byte pattern repeated from the start of the file
+type patternPass []byte
+
+func (p patternPass) Fill(buf []byte, offset int64) error {
+	start := int(offset % int64(len(p)))
+	for i := range buf {
+		buf[i] = p[(start+i)%len(p)]
+	}
+	return nil
+}
+
+// RandomPass returns a pass writing random bytes
+func RandomPass() Pass {
+	return randomPass{}
+}
+
+// PatternPass returns a pass repeating a byte pattern over the whole file (e.g. 0x92 0x49 0x24).
+// An empty pattern writes random bytes.
+func PatternPass(pattern ...byte) Pass {
+	if len(pattern) == 0 {
+		return RandomPass()
+	}
+	return patternPass(append([]byte(nil), pattern...))
+}
+
+// ZeroPass returns a pass writing zeros (0x00)
+func ZeroPass() Pass {
+	return PatternPass(0x00)
+}
+
+// OnePass returns a pass writing ones (0xFF)
+func OnePass() Pass {
+	return PatternPass(0xFF)
+}
+
+/*************/
+/*  Schemes  */
+/*************/
+
+// Repeat returns n times the same pass
+func Repeat(p Pass, n uint) []Pass {
+	passes := make([]Pass, n)
+	for i := range passes {
+		passes[i] = p
+	}
+	return passes
+}
+
+// RandomPasses returns n random passes (the scheme of ShredN)
+func RandomPasses(n uint) []Pass {
+	return Repeat(RandomPass(), n)
+}
+
+// DoD522022M returns the 3 passes of DoD 5220.22-M: zeros, ones and random bytes
+func DoD522022M() []Pass {
+	return []Pass{ZeroPass(), OnePass(), RandomPass()}
+}
+
+// gutmannPatterns are the 27 fixed patterns of the passes 5 to 31 of the Gutmann method
+var gutmannPatterns = [][]byte{
+	{0x55}, {0xAA},
+	{0x92, 0x49, 0x24}, {0x49, 0x24, 0x92}, {0x24, 0x92, 0x49},
+	{0x00}, {0x11}, {0x22}, {0x33}, {0x44}, {0x55}, {0x66}, {0x77},
+	{0x88}, {0x99}, {0xAA}, {0xBB}, {0xCC}, {0xDD}, {0xEE}, {0xFF},
+	{0x92, 0x49, 0x24}, {0x49, 0x24, 0x92}, {0x24, 0x92, 0x49},
+	{0x6D, 0xB6, 0xDB}, {0xB6, 0xDB, 0x6D}, {0xDB, 0x6D, 0xB6},
+}
+
+// Gutmann returns the 35 passes of the Gutmann method: 4 random passes, 27 fixed patterns and 4 random passes
+// (the fixed patterns are written in the order of the paper)
+func Gutmann() []Pass {
+	passes := RandomPasses(4)
+	for _, p := range gutmannPatterns {
+		passes = append(passes, PatternPass(p...))
+	}
+	return append(passes, RandomPasses(4)...)
+}
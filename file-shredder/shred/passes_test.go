@@ -0,0 +1,96 @@
+package shreder
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+/****************/
+/*     Unit     */
+/****************/
+
+// (Unit Test) Test that a pattern continues across the chunks of a file
+func TestPatternPassFill(t *testing.T) {
+	pass := PatternPass(0x92, 0x49, 0x24)
+	first := make([]byte, 4)
+	second := make([]byte, 5)
+	if err := pass.Fill(first, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pass.Fill(second, 4); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x92, 0x49, 0x24, 0x92, 0x49, 0x24, 0x92, 0x49, 0x24}
+	if found := append(first, second...); !bytes.Equal(found, expected) {
+		t.Fatalf("pattern fill, expected: %x, found: %x", expected, found)
+	}
+}
+
+// (Unit Test) Test the number of passes of the schemes
+func TestSchemes(t *testing.T) {
+	testSchemeLen(t, "RandomPasses(3)", RandomPasses(3), 3)
+	testSchemeLen(t, "DoD522022M", DoD522022M(), 3)
+	testSchemeLen(t, "Gutmann", Gutmann(), 35)
+	testSchemeLen(t, "DoD522022M with zero pass", Options{Passes: DoD522022M(), Zero: true}.passes(), 4)
+	testSchemeLen(t, "zero pass only", Options{Zero: true}.passes(), 1)
+}
+
+func testSchemeLen(t *testing.T, name string, passes []Pass, expected int) {
+	if len(passes) != expected {
+		t.Fatalf("%s, expected: %d passes, found: %d", name, expected, len(passes))
+	}
+}
+
+// (Unit Test) Test options without any pass
+func TestShredWithOptionsNoPass(t *testing.T) {
+	err := ShredWithOptions("fakepath", Options{})
+	var se *ShredError
+	if !errors.As(err, &se) || se.Code != ErrInvalidIterationCount {
+		t.Fatalf("ShredWithOptions without passes, expected: %s, found: %v", errInvalidItrationCount, err)
+	}
+}
+
+/*****************/
+/*  Integration  */
+/*****************/
+
+// Test - Overwrite Pass - Fixed patterns are written to the whole file (larger than the buffer)
+func TestOverwritePassPatterns(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefghijklmonpqrstuvwxyz"), 100)
+	for _, pattern := range [][]byte{{0x00}, {0xFF}, {0x6D, 0xB6, 0xDB}} {
+		path := createTempFile(t, data)
+		if err := overwritePass(osFS{}, path, int64(len(data)), PatternPass(pattern...), nil); err != nil {
+			t.Fatal(err)
+		}
+		verifyFileOverwriteSize(t, path, int64(len(data)))
+		filedata, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := bytes.Repeat(pattern, len(data)/len(pattern)+1)[:len(data)]
+		if !bytes.Equal(filedata, expected) {
+			t.Fatalf("after overwrite with pattern %x for path: %s, found: %x...", pattern, path, filedata[:8])
+		}
+	}
+}
+
+// Test - Shred With Options - The file is deleted after the passes of every scheme
+func TestShredWithOptions(t *testing.T) {
+	data := []byte("abcdefghijklmonpqrstuvwxyz")
+	for _, opts := range []Options{
+		{Passes: RandomPasses(1)},
+		{Passes: Repeat(OnePass(), 2), Zero: true},
+		{Passes: DoD522022M()},
+		{Passes: Gutmann()},
+	} {
+		path := createTempFile(t, data)
+		if err := ShredWithOptions(path, opts); err != nil {
+			t.Fatalf("ShredWithOptions with %d passes, found: %v", len(opts.Passes), err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("after shred for path: %s, expected the file to be deleted, found: %v", path, err)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package shreder
 
 import (
-	"crypto/rand"
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 )
 
@@ -19,6 +23,11 @@ const (
 	ErrPathIsNotARegularFile
 	ErrPathNotExists
 	ErrShredderFileCorruption
+	ErrShredderVerificationFailed
+	ErrPathIsNotADirectory
+	ErrProtectedPath
+	ErrShredderIOFailure
+	ErrShredderCanceled
 )
 
 const (
@@ -26,22 +35,47 @@ const (
 	errPathIsNotAShredableFile = "not a shredable file"
 	errPathNotExists           = "invalid path"
 	errShredderFileCorruption  = "shredder corrupted the file"
+	errShredderVerification    = "file content differs from the written pass"
+	errPathIsNotADirectory     = "not a directory"
+	errProtectedPath           = "protected path"
+	errShredderIOFailure       = "i/o failure"
+	errShredderCanceled        = "shredding canceled"
 )
 
 func (f ShredErrCode) String() string {
 	return [...]string{
 		errInvalidItrationCount,
 		errPathIsNotAShredableFile,
+		errPathNotExists,
+		errShredderFileCorruption,
+		errShredderVerification,
+		errPathIsNotADirectory,
+		errProtectedPath,
+		errShredderIOFailure,
+		errShredderCanceled,
 	}[f]
 }
 
 // ShredError implements externally visible error struct
 type ShredError struct {
 	Code ShredErrCode
+	Path string // file of the error (set by the batch functions)
+	Err  error  // underlying error (e.g. an os or a context error)
 }
 
 func (s *ShredError) Error() string {
-	return fmt.Sprintf("%s (code %d)", s.Code.String(), s.Code)
+	msg := fmt.Sprintf("%s (code %d)", s.Code.String(), s.Code)
+	if s.Path != "" {
+		msg = s.Path + ": " + msg
+	}
+	if s.Err != nil {
+		msg += ": " + s.Err.Error()
+	}
+	return msg
+}
+
+func (s *ShredError) Unwrap() error {
+	return s.Err
 }
 
 func newShredError(c ShredErrCode) *ShredError {
@@ -54,20 +88,83 @@ func newShredError(c ShredErrCode) *ShredError {
 /*     External     */
 /********************/
 
+// Options selects how a file is shredded
+type Options struct {
+	// Passes are the overwrite passes in order, e.g. RandomPasses(3), DoD522022M() or Gutmann()
+	Passes []Pass
+	// Zero adds a final pass of zeros to hide the shredding (like `shred -z`)
+	Zero bool
+	// Verify re-reads the file after every pass and compares it with the written bytes (with a SHA-256 of the pass,
+	// so the pass is not kept in memory). A mismatch returns ErrShredderVerificationFailed.
+	Verify bool
+	// Obfuscate renames the file to progressively shorter random names before deleting it, so that its name is not
+	// left in the directory (like `shred -u`)
+	Obfuscate bool
+}
+
+// passes returns all the passes of the options (with the final zero pass)
+func (o Options) passes() []Pass {
+	passes := append([]Pass(nil), o.Passes...)
+	if o.Zero {
+		passes = append(passes, ZeroPass())
+	}
+	return passes
+}
+
 // Shred takes a file path, overwrites it thrice and then deletes the file
 func Shred(path string) error {
 	return ShredN(path, 3)
 }
 
+// ShredN overwrites a file with random bytes n times and then deletes the file
 func ShredN(path string, iterations uint) error {
+	return ShredWithOptions(path, Options{Passes: RandomPasses(iterations)})
+}
+
+// ShredWithOptions overwrites a file with the passes of the options and then deletes the file
+func ShredWithOptions(path string, opts Options) error {
+	return shredFile(osFS{}, path, opts)
+}
+
+/**************/
+/*  Internal  */
+/**************/
+
+// fileSystem is the file operations of the shredder: the OS (a symlink is followed to its file) or a directory
+// opened with os.OpenRoot (a symlink is never followed out of the directory, see ShredTree)
+type fileSystem interface {
+	open(name string, flag int) (*os.File, error)
+	stat(name string) (os.FileInfo, error)
+	link(oldname, newname string) error // fails if newname exists (unlike a rename)
+	remove(name string) error
+}
+
+type osFS struct{}
+
+func (osFS) open(name string, flag int) (*os.File, error) { return os.OpenFile(name, flag, 0) }
+func (osFS) stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (osFS) link(oldname, newname string) error           { return os.Link(oldname, newname) }
+func (osFS) remove(name string) error                     { return os.Remove(name) }
+
+// rootFS never follows a symlink out of the root and does not follow the symlink of the file to shred
+type rootFS struct{ root *os.Root }
+
+func (r rootFS) open(name string, flag int) (*os.File, error) { return r.root.OpenFile(name, flag, 0) }
+func (r rootFS) stat(name string) (os.FileInfo, error)        { return r.root.Lstat(name) }
+func (r rootFS) link(oldname, newname string) error           { return r.root.Link(oldname, newname) }
+func (r rootFS) remove(name string) error                     { return r.root.Remove(name) }
+
+// shredFile overwrites a file with the passes of the options and then deletes the file
+func shredFile(fsys fileSystem, path string, opts Options) error {
 
 	// check iteration count
-	if iterations <= 0 {
+	passes := opts.passes()
+	if len(passes) == 0 {
 		return newShredError(ErrInvalidIterationCount)
 	}
 
 	// check if path exists
-	fileStat, err := os.Stat(path)
+	fileStat, err := fsys.stat(path)
 
 	if err != nil {
 		return err
@@ -83,37 +180,58 @@ func ShredN(path string, iterations uint) error {
 
 	fileSize := fileStat.Size()
 
-	// iterate over the file and overwrite it
-	var i uint
-	for i = 0; i < iterations; i++ {
+	// iterate over the passes and overwrite the file
+	for _, pass := range passes {
 		// overwrite file
-		if err := overwriteOnce(path, fileSize); err != nil {
+		var sum hash.Hash
+		if opts.Verify {
+			sum = sha256.New()
+		}
+		if err := overwritePass(fsys, path, fileSize, pass, sum); err != nil {
 			return err
 		}
 		//verfy file size
-		fileStat, err := os.Stat(path)
+		fileStat, err := fsys.stat(path)
 		if err != nil {
 			return err
 		}
 		if fileSize != fileStat.Size() {
 			return newShredError(ErrShredderFileCorruption)
 		}
+		// verify file content
+		if opts.Verify {
+			if err := verifyPass(fsys, path, fileSize, sum.Sum(nil)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// hide the name of the file
+	if opts.Obfuscate {
+		current, err := obfuscateName(fsys, path)
+		if err != nil {
+			// the data is already overwritten, so the file is still deleted under the name it has now
+			err = fmt.Errorf("obfuscate name (renamed to %s): %w", current, err)
+			return errors.Join(err, deleteFile(fsys, current))
+		}
+		path = current
 	}
 
 	// delete the file
-	return deleteFile(path)
+	return deleteFile(fsys, path)
 }
 
-/**************/
-/*  Internal  */
-/**************/
-
-// overwriteOnce writes n-bytes to a file
+// overwriteOnce writes n random bytes to a file
 func overwriteOnce(path string, totalBytes int64) error {
+	return overwritePass(osFS{}, path, totalBytes, RandomPass(), nil)
+}
+
+// overwritePass writes n bytes of a pass to a file. The written bytes are also written to sum if it is not nil.
+func overwritePass(fsys fileSystem, path string, totalBytes int64, pass Pass, sum hash.Hash) error {
 
 	// check if file can be opened with read/write permissions
 	// open file with sync IO so we can write the files in place (peformance not checked)
-	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_SYNC, 0)
+	fh, err := fsys.open(path, os.O_WRONLY|os.O_SYNC)
 	if err != nil {
 		return err
 	}
@@ -124,8 +242,8 @@ func overwriteOnce(path string, totalBytes int64) error {
 	// overwrite file
 	for bytesWritten < totalBytes {
 		bytesToWrite := min(totalBytes-bytesWritten, bufferSize)
-		bytesInBuffer, err := rand.Read(buf[:bytesToWrite]) // read buffer upto the max file size
-		if err != nil {
+		// fill the buffer upto the max file size
+		if err := pass.Fill(buf[:bytesToWrite], bytesWritten); err != nil {
 			return err
 		}
 		// write buffer to the file
@@ -133,19 +251,42 @@ func overwriteOnce(path string, totalBytes int64) error {
 		if _, err := fh.Write(buf[:bytesToWrite]); err != nil {
 			return err
 		}
+		if sum != nil {
+			sum.Write(buf[:bytesToWrite])
+		}
 
 		// inrcement bytes written
-		bytesWritten += int64(bytesInBuffer)
+		bytesWritten += bytesToWrite
 	}
 
 	// write flush on the file so that all the contents are written to the file though it shouldn't be needed due to O_SYNC
 	return fh.Sync()
 }
 
+// verifyPass re-reads n bytes of a file and compares their SHA-256 with the hash of the written pass.
+// Note: the bytes may be read from the page cache of the OS instead of the disk.
+func verifyPass(fsys fileSystem, path string, totalBytes int64, expected []byte) error {
+	fh, err := fsys.open(path, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer fh.Close() // close file
+
+	sum := sha256.New()
+	written, err := io.CopyBuffer(sum, io.LimitReader(fh, totalBytes), make([]byte, bufferSize))
+	if err != nil {
+		return err
+	}
+	if written != totalBytes || !bytes.Equal(sum.Sum(nil), expected) {
+		return newShredError(ErrShredderVerificationFailed)
+	}
+	return nil
+}
+
 // deletes a file if it exists or returns an error. No guard rails are present so it must not be run as root.
-func deleteFile(path string) error {
+func deleteFile(fsys fileSystem, path string) error {
 
-	return os.Remove(path)
+	return fsys.remove(path)
 }
 
 func min(a, b int64) int64 {
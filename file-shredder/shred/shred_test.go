@@ -114,7 +114,7 @@ func TestOverwriteOnceTextFile(t *testing.T) {
 	path := createTempFile(t, data)
 	// overwrite file
 	if err := overwriteOnce(path, int64(expectedSize)); err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	// verify file size
 	verifyFileOverwriteSize(t, path, int64(expectedSize))
@@ -0,0 +1,190 @@
+package shreder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+/************/
+/*  Report  */
+/************/
+
+// FileStatus is the result of a file of a tree
+type FileStatus int
+
+const (
+	FileShredded FileStatus = iota // the file was overwritten and deleted (or the directory removed)
+	FileSkipped                    // the file is not a regular file (symlink, device, socket, pipe...)
+	FileFailed                     // the file could not be shredded (or read)
+)
+
+func (s FileStatus) String() string {
+	return [...]string{"shredded", "skipped", "failed"}[s]
+}
+
+// FileResult is the result of a file of a tree
+type FileResult struct {
+	Path   string // root joined with the path of the file in the tree
+	Status FileStatus
+	Err    error // reason why the file was skipped or failed
+}
+
+// TreeReport is the result of every file of a tree
+type TreeReport struct {
+	Files []FileResult // in the order of the walk (lexical)
+	Dirs  []string     // removed directories, bottom-up
+}
+
+// Count returns the number of files with a status
+func (r *TreeReport) Count(status FileStatus) int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns the errors of the failed files joined (nil if no file failed)
+func (r *TreeReport) Err() error {
+	var errs []error
+	for _, f := range r.Files {
+		if f.Status == FileFailed {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, f.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/**********/
+/*  Tree  */
+/**********/
+
+// ProtectedPaths are the directories that ShredTree refuses to shred (the home directory of the user too)
+var ProtectedPaths = []string{
+	"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib32", "/lib64", "/opt", "/proc", "/root", "/run",
+	"/sbin", "/srv", "/sys", "/tmp", "/usr", "/var",
+}
+
+// ShredTree shreds every regular file of a directory tree with the options and then removes the directories that
+// were emptied, bottom-up (the root too). Symlinks, devices, sockets and pipes are skipped and reported: symlinks are
+// never followed, so nothing out of the root is shredded. The root must be a directory (not a symlink) and not a
+// protected path. The failures of the files are in the report (see TreeReport.Err), the error is returned when the
+// tree can't be walked.
+func ShredTree(root string, opts Options) (*TreeReport, error) {
+
+	// check iteration count
+	if len(opts.passes()) == 0 {
+		return nil, newShredError(ErrInvalidIterationCount)
+	}
+
+	// check the root (and the directory it resolves to through the symlinks of its parents)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	rootStat, err := os.Lstat(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !rootStat.IsDir() {
+		return nil, newShredError(ErrPathIsNotADirectory)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	if isProtectedPath(absRoot) || isProtectedPath(resolvedRoot) {
+		return nil, newShredError(ErrProtectedPath)
+	}
+
+	// the files are opened through the root so that no symlink is followed out of it
+	dir, err := os.OpenRoot(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	report := &TreeReport{}
+	var dirs []string
+	kept := map[string]bool{} // directories with a file that was not shredded
+	keep := func(dir string) {
+		for ; !kept[dir]; dir = filepath.Dir(dir) {
+			kept[dir] = true
+			if dir == "." {
+				return
+			}
+		}
+	}
+	result := func(path string, status FileStatus, err error) {
+		report.Files = append(report.Files, FileResult{Path: filepath.Join(root, path), Status: status, Err: err})
+		if status != FileShredded {
+			keep(filepath.Dir(path))
+		}
+	}
+
+	err = fs.WalkDir(dir.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d == nil {
+				return err // the root can't be read
+			}
+			// the directory can't be read: it is reported and kept and its files are skipped
+			path = filepath.FromSlash(path)
+			result(path, FileFailed, err)
+			keep(path)
+			return nil
+		}
+		path = filepath.FromSlash(path)
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, path)
+		case d.Type().IsRegular():
+			if err := shredFile(rootFS{dir}, path, opts); err != nil {
+				result(path, FileFailed, err)
+			} else {
+				result(path, FileShredded, nil)
+			}
+		default:
+			result(path, FileSkipped, newShredError(ErrPathIsNotARegularFile))
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// remove the emptied directories, bottom-up (the walk lists a directory before its files)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if kept[dirs[i]] {
+			continue
+		}
+		var err error
+		if dirs[i] == "." {
+			err = os.Remove(absRoot) // the root itself is removed by its path
+		} else {
+			err = dir.Remove(dirs[i])
+		}
+		if err != nil {
+			result(dirs[i], FileFailed, err)
+			continue
+		}
+		report.Dirs = append(report.Dirs, filepath.Join(root, dirs[i]))
+	}
+	return report, nil
+}
+
+// isProtectedPath checks if an absolute path is a protected path or the home directory of the user
+func isProtectedPath(path string) bool {
+	path = filepath.Clean(path)
+	for _, p := range ProtectedPaths {
+		if path == filepath.Clean(p) {
+			return true
+		}
+	}
+	home, err := os.UserHomeDir()
+	return err == nil && path == filepath.Clean(home)
+}
@@ -0,0 +1,154 @@
+package shreder
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*****************/
+/*    Helpers    */
+/*****************/
+
+// writeTreeFile creates a file and its parent directories
+func writeTreeFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verifyTreeResult(t *testing.T, report *TreeReport, path string, expected FileStatus) {
+	for _, f := range report.Files {
+		if f.Path == path {
+			if f.Status != expected {
+				t.Fatalf("ShredTree for path: %s, expected: %s, found: %s (%v)", path, expected, f.Status, f.Err)
+			}
+			return
+		}
+	}
+	t.Fatalf("ShredTree for path: %s, expected: %s, found: no result", path, expected)
+}
+
+func verifyPathExists(t *testing.T, path string, expected bool) {
+	_, err := os.Lstat(path)
+	if exists := err == nil; exists != expected {
+		t.Fatalf("after ShredTree for path: %s, expected exists: %t, found: %t", path, expected, exists)
+	}
+}
+
+/*****************/
+/*  Integration  */
+/*****************/
+
+// Test - Shred Tree - Regular files are shredded, symlinks and sockets are skipped and the emptied directories removed
+func TestShredTree(t *testing.T) {
+	data := []byte("abcdefghijklmonpqrstuvwxyz")
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside")
+	writeTreeFile(t, outside, data)
+
+	writeTreeFile(t, filepath.Join(root, "a"), data)
+	writeTreeFile(t, filepath.Join(root, "empty", "b"), nil)
+	writeTreeFile(t, filepath.Join(root, "sub", "deeper", "c"), data)
+	if err := os.Mkdir(filepath.Join(root, "links"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "links", "file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Dir(outside), filepath.Join(root, "links", "dir")); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(root, "sub", "socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	report, err := ShredTree(root, Options{Passes: RandomPasses(1), Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyTreeResult(t, report, filepath.Join(root, "a"), FileShredded)
+	verifyTreeResult(t, report, filepath.Join(root, "empty", "b"), FileShredded)
+	verifyTreeResult(t, report, filepath.Join(root, "sub", "deeper", "c"), FileShredded)
+	verifyTreeResult(t, report, filepath.Join(root, "links", "file"), FileSkipped)
+	verifyTreeResult(t, report, filepath.Join(root, "links", "dir"), FileSkipped)
+	verifyTreeResult(t, report, filepath.Join(root, "sub", "socket"), FileSkipped)
+	if report.Count(FileShredded) != 3 || report.Count(FileSkipped) != 3 || report.Err() != nil {
+		t.Fatalf("ShredTree, expected: 3 shredded and 3 skipped files, found: %d shredded, %d skipped (%v)",
+			report.Count(FileShredded), report.Count(FileSkipped), report.Err())
+	}
+
+	// the files out of the root are untouched
+	filedata, err := os.ReadFile(outside)
+	if err != nil || string(filedata) != string(data) {
+		t.Fatalf("after ShredTree for path: %s, expected: %s, found: %s (%v)", outside, data, filedata, err)
+	}
+	// the emptied directories are removed, the directories with skipped files are kept
+	verifyPathExists(t, filepath.Join(root, "a"), false)
+	verifyPathExists(t, filepath.Join(root, "empty"), false)
+	verifyPathExists(t, filepath.Join(root, "sub", "deeper"), false)
+	verifyPathExists(t, filepath.Join(root, "sub", "socket"), true)
+	verifyPathExists(t, filepath.Join(root, "links", "file"), true)
+	if len(report.Dirs) != 2 || report.Dirs[0] != filepath.Join(root, "sub", "deeper") {
+		t.Fatalf("ShredTree, expected: removed directories sub/deeper and empty, found: %v", report.Dirs)
+	}
+}
+
+// Test - Shred Tree - An emptied root is removed
+func TestShredTreeRemovesRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	writeTreeFile(t, filepath.Join(root, "dir", "a"), []byte("abc"))
+	report, err := ShredTree(root, Options{Passes: RandomPasses(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyPathExists(t, root, false)
+	if len(report.Dirs) != 2 || report.Dirs[1] != root {
+		t.Fatalf("ShredTree, expected: removed directories dir and the root, found: %v", report.Dirs)
+	}
+}
+
+// Test - Shred Tree - Protected paths, symlinks and files are refused as root
+func TestShredTreeRefusedRoots(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	writeTreeFile(t, file, []byte("abc"))
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("/", link); err != nil {
+		t.Fatal(err)
+	}
+	parentLink := filepath.Join(dir, "parent")
+	if err := os.Symlink("/", parentLink); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		root     string
+		expected ShredErrCode
+	}{
+		{"/", ErrProtectedPath},
+		{"/etc/", ErrProtectedPath},
+		{filepath.Join(parentLink, "usr"), ErrProtectedPath}, // resolves to /usr
+		{link, ErrPathIsNotADirectory},
+		{file, ErrPathIsNotADirectory},
+	} {
+		_, err := ShredTree(c.root, Options{Passes: RandomPasses(1)})
+		var se *ShredError
+		if !errors.As(err, &se) || se.Code != c.expected {
+			t.Fatalf("ShredTree for path: %s, expected: %s, found: %v", c.root, c.expected.String(), err)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if _, err := ShredTree(home, Options{Passes: RandomPasses(1)}); err == nil {
+			t.Fatalf("ShredTree for the home directory: %s, expected: %s, found: no error", home, errProtectedPath)
+		}
+	}
+	verifyPathExists(t, file, true)
+}
@@ -0,0 +1,81 @@
+package shreder
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+)
+
+/****************/
+/*     Unit     */
+/****************/
+
+// (Unit Test) Test that every error code has a message
+func TestShredErrCodeString(t *testing.T) {
+	for code := ErrInvalidIterationCount; code <= ErrShredderCanceled; code++ {
+		if newShredError(code).Error() == "" {
+			t.Fatalf("ShredError with code %d, expected a message", code)
+		}
+	}
+	if found := newShredError(ErrShredderVerificationFailed).Code.String(); found != errShredderVerification {
+		t.Fatalf("ErrShredderVerificationFailed, expected: %s, found: %s", errShredderVerification, found)
+	}
+}
+
+/*****************/
+/*  Integration  */
+/*****************/
+
+// Test - Verify Pass - The written random and fixed passes are verified (a file larger than the buffer)
+func TestVerifyPass(t *testing.T) {
+	data := make([]byte, 3*bufferSize+7)
+	for _, pass := range []Pass{RandomPass(), ZeroPass(), PatternPass(0x92, 0x49, 0x24)} {
+		path := createTempFile(t, data)
+		sum := sha256.New()
+		if err := overwritePass(osFS{}, path, int64(len(data)), pass, sum); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyPass(osFS{}, path, int64(len(data)), sum.Sum(nil)); err != nil {
+			t.Fatalf("verify pass for path: %s, expected no error, found: %v", path, err)
+		}
+	}
+}
+
+// Test - Verify Pass - A byte changed after the pass is detected
+func TestVerifyPassMismatch(t *testing.T) {
+	data := make([]byte, 2*bufferSize)
+	path := createTempFile(t, data)
+	sum := sha256.New()
+	if err := overwritePass(osFS{}, path, int64(len(data)), OnePass(), sum); err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a byte after the pass (like a write that never reached the disk)
+	fh, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fh.WriteAt([]byte{0x00}, bufferSize+1); err != nil {
+		t.Fatal(err)
+	}
+	fh.Close()
+
+	err = verifyPass(osFS{}, path, int64(len(data)), sum.Sum(nil))
+	var se *ShredError
+	if !errors.As(err, &se) || se.Code != ErrShredderVerificationFailed {
+		t.Fatalf("verify pass after a change, expected: %s, found: %v", errShredderVerification, err)
+	}
+}
+
+// Test - Shred With Options - Verified schemes delete the file
+func TestShredWithOptionsVerify(t *testing.T) {
+	data := []byte("abcdefghijklmonpqrstuvwxyz")
+	path := createTempFile(t, data)
+	if err := ShredWithOptions(path, Options{Passes: DoD522022M(), Zero: true, Verify: true}); err != nil {
+		t.Fatalf("ShredWithOptions with verification, found: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("after shred for path: %s, expected the file to be deleted, found: %v", path, err)
+	}
+}